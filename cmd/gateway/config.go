@@ -2,14 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/RogueTeam/8ball/cmd/gateway/internal/router"
 	"github.com/RogueTeam/8ball/decimal"
 	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/internal/walletrpc/old_rpc"
 	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/metrics"
+	"github.com/RogueTeam/8ball/oracles"
+	httporacle "github.com/RogueTeam/8ball/oracles/http"
+	"github.com/RogueTeam/8ball/oracles/static"
+	"github.com/RogueTeam/8ball/wallets"
 	"github.com/RogueTeam/8ball/wallets/monero"
+	"github.com/RogueTeam/8ball/wallets/pool"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gabstv/httpdigest"
 )
@@ -22,6 +34,71 @@ type (
 		RpcUrl      string  `yaml:"rpc-url"`
 		RpcUsername *string `yaml:"rpc-username,omitempty"`
 		RpcPassword *string `yaml:"rpc-password,omitempty"`
+		// Optional monerod url used to verify the transfers seen in the pool
+		DaemonUrl string `yaml:"daemon-url,omitempty"`
+		// Interval between the polls notifying the incoming transfers. Defaults to 10s
+		NotifyInterval time.Duration `yaml:"notify-interval,omitempty"`
+	}
+	Webhook struct {
+		Secret      string        `yaml:"secret"`
+		MaxAttempts uint64        `yaml:"max-attempts"`
+		Backoff     time.Duration `yaml:"backoff"`
+		MaxBackoff  time.Duration `yaml:"max-backoff"`
+		Timeout     time.Duration `yaml:"timeout"`
+		// Callbacks to loopback, private and link-local addresses are rejected unless enabled
+		AllowPrivateNetworks bool `yaml:"allow-private-networks,omitempty"`
+	}
+	Retry struct {
+		MaxAttempts uint64        `yaml:"max-attempts"`
+		Backoff     time.Duration `yaml:"backoff"`
+		MaxBackoff  time.Duration `yaml:"max-backoff"`
+	}
+	Pow struct {
+		Bits       uint64        `yaml:"bits"`
+		Expiration time.Duration `yaml:"expiration"`
+	}
+	Confirmation struct {
+		MaxAmount     decimal.Decimal `yaml:"max-amount"`
+		Confirmations uint64          `yaml:"confirmations"`
+	}
+	Refund struct {
+		Underpaid bool `yaml:"underpaid"`
+		Overpaid  bool `yaml:"overpaid"`
+	}
+	Oracle struct {
+		// YAML file mapping currencies to the price of a single XMR
+		RatesFile string `yaml:"rates-file,omitempty"`
+		// Local HTTP service answering with the same mapping in JSON
+		Url     string        `yaml:"url,omitempty"`
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+	}
+	MerchantWebhook struct {
+		Secret      string `yaml:"secret,omitempty"`
+		CallbackUrl string `yaml:"callback-url,omitempty"`
+	}
+	// Settings of a merchant created with the -new-merchant flag
+	Merchant struct {
+		Name               string          `yaml:"name"`
+		FeePercentage      *uint64         `yaml:"fee-percentage,omitempty"`
+		MinAmount          decimal.Decimal `yaml:"min-amount,omitempty"`
+		MaxAmount          decimal.Decimal `yaml:"max-amount,omitempty"`
+		Timeout            time.Duration   `yaml:"receive-timeout,omitempty"`
+		BeneficiaryAddress string          `yaml:"beneficiary-address,omitempty"`
+		Webhook            MerchantWebhook `yaml:"webhook,omitempty"`
+	}
+	Log struct {
+		// debug, info, warn or error. Defaults to info
+		Level string `yaml:"level,omitempty"`
+		// Writes JSON records instead of key=value text
+		JSON bool `yaml:"json,omitempty"`
+		// Prints addresses and transaction hashes. They are redacted by default
+		Reveal bool `yaml:"reveal,omitempty"`
+	}
+	// Operator API. Disabled when no listen address is configured
+	Admin struct {
+		ListenAddress string `yaml:"listen-address"`
+		Username      string `yaml:"username"`
+		Password      string `yaml:"password"`
 	}
 	Config struct {
 		ProcessInterval    time.Duration   `yaml:"processInterval"`
@@ -33,39 +110,206 @@ type (
 		FeePercentage      uint64          `yaml:"fee-percentage"`
 		BeneficiaryAddress string          `yaml:"beneficiary-address"`
 		Wallet             Wallet          `yaml:"wallet"`
+		Webhook            Webhook         `yaml:"webhook"`
+		Pow                Pow             `yaml:"pow"`
+		RecycleQuarantine  time.Duration   `yaml:"recycle-quarantine"`
+		OrphanScanInterval time.Duration   `yaml:"orphan-scan-interval"`
+		LateDepositPolicy  string          `yaml:"late-deposit-policy"`
+		Confirmations      []Confirmation  `yaml:"confirmations"`
+		Refund             Refund          `yaml:"refund"`
+		SingleTransaction  bool            `yaml:"single-transaction"`
+		Oracle             Oracle          `yaml:"oracle"`
+		RequireApiKey      bool            `yaml:"require-api-key"`
+		Admin              Admin           `yaml:"admin"`
+		Retry              Retry           `yaml:"retry"`
+		IdempotencyWindow  time.Duration   `yaml:"idempotency-window"`
+		// Serves Prometheus metrics at /metrics of the admin listener. Requires the admin listen address
+		Metrics bool `yaml:"metrics"`
+		Log     Log  `yaml:"log"`
+		// Time the servers have to finish the in-flight requests on shutdown
+		ShutdownTimeout time.Duration `yaml:"shutdown-timeout"`
+		// Time the processing lease survives a crashed instance
+		LeaseTTL time.Duration `yaml:"lease-ttl"`
+		// Wallets sharing the receivers. Replaces wallet when set. The receivers know their wallet
+		// by its position so new wallets can only be appended
+		Wallets []Wallet `yaml:"wallets"`
+		// Prepares the transfers without relaying them. They are signed offline and submitted
+		// through the admin API
+		ViewOnly bool `yaml:"view-only"`
 	}
 )
 
-func (c *Config) Compile() (ctrl gateway.Controller, config gateway.Config, err error) {
-	opt := badger.DefaultOptions(c.DatabasePath)
+func (m *Merchant) Compile() (merchant gateway.Merchant) {
+	merchant = gateway.Merchant{
+		Name:          m.Name,
+		FeePercentage: m.FeePercentage,
+		Timeout:       m.Timeout,
+		Address:       m.BeneficiaryAddress,
+		Webhook: gateway.MerchantWebhook{
+			Secret:      m.Webhook.Secret,
+			CallbackUrl: m.Webhook.CallbackUrl,
+		},
+	}
+	if m.MinAmount.Value != nil {
+		merchant.MinAmount = m.MinAmount.ToUint64()
+	}
+	if m.MaxAmount.Value != nil {
+		merchant.MaxAmount = m.MaxAmount.ToUint64()
+	}
+	return merchant
+}
 
+// Opens the wallet in its wallet-rpc
+func (w *Wallet) Compile(m *metrics.Metrics) (wallet *monero.Wallet, err error) {
 	var httpClient http.Client
-	if c.Wallet.RpcUsername != nil && c.Wallet.RpcPassword != nil {
-		httpClient.Transport = httpdigest.New(*c.Wallet.RpcUsername, *c.Wallet.RpcPassword)
+	if w.RpcUsername != nil && w.RpcPassword != nil {
+		httpClient.Transport = httpdigest.New(*w.RpcUsername, *w.RpcPassword)
 	}
 
 	moneroClient := rpc.New(rpc.Config{
-		Url:    c.Wallet.RpcUrl,
-		Client: &httpClient,
+		Url:      w.RpcUrl,
+		Client:   &httpClient,
+		Observer: m.Rpc,
 	})
 	err = moneroClient.OpenWallet(context.TODO(), &rpc.OpenWalletRequest{
-		Filename: c.Wallet.Filename,
-		Password: c.Wallet.Password,
+		Filename: w.Filename,
+		Password: w.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet: %w", err)
+	}
+
+	var daemonClient *old_rpc.Client
+	if w.DaemonUrl != "" {
+		daemonClient = old_rpc.New(old_rpc.Config{Address: w.DaemonUrl})
+	}
+
+	wallet = monero.New(monero.Config{
+		Accounts: true,
+		Client:   moneroClient,
+		Daemon:   daemonClient,
+
+		NotifyInterval: w.NotifyInterval,
+	})
+	return wallet, nil
+}
+
+// Logger configured by the log section
+func (l *Log) Compile() (logger *slog.Logger, err error) {
+	var level slog.Level
+	if l.Level != "" {
+		err = level.UnmarshalText([]byte(l.Level))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level: %w", err)
+		}
+	}
+
+	logger = logging.New(logging.Config{
+		Level:  level,
+		JSON:   l.JSON,
+		Reveal: l.Reveal,
 	})
+	return logger, nil
+}
+
+func (c *Config) Compile(m *metrics.Metrics, logger *slog.Logger) (ctrl gateway.Controller, config gateway.Config, err error) {
+	opt := badger.DefaultOptions(c.DatabasePath)
+
+	lateDepositPolicy := gateway.LateDepositPolicy(c.LateDepositPolicy)
+	err = lateDepositPolicy.Validate()
 	if err != nil {
-		return ctrl, config, fmt.Errorf("failed to open wallet: %w", err)
+		return ctrl, config, fmt.Errorf("invalid late deposit policy: %w", err)
+	}
+
+	var oracle oracles.Oracle
+	switch {
+	case c.Oracle.RatesFile != "":
+		oracle, err = static.Load(c.Oracle.RatesFile)
+		if err != nil {
+			return ctrl, config, fmt.Errorf("failed to load rates: %w", err)
+		}
+	case c.Oracle.Url != "":
+		timeout := c.Oracle.Timeout
+		if timeout == 0 {
+			timeout = httporacle.DefaultTimeout
+		}
+		oracle = httporacle.New(httporacle.Config{
+			Url:    c.Oracle.Url,
+			Client: &http.Client{Timeout: timeout},
+		})
+	}
+
+	if c.ViewOnly && len(c.Wallets) > 0 {
+		return ctrl, config, errors.New("view-only mode doesn't support wallet pools")
+	}
+
+	var wallet wallets.Wallet
+	if len(c.Wallets) == 0 {
+		wallet, err = c.Wallet.Compile(m)
+		if err != nil {
+			return ctrl, config, err
+		}
+	} else {
+		var backends []wallets.Wallet
+		for index, w := range c.Wallets {
+			backend, err := w.Compile(m)
+			if err != nil {
+				return ctrl, config, fmt.Errorf("failed to compile wallet %d: %w", index, err)
+			}
+			backends = append(backends, backend)
+		}
+
+		wallet, err = pool.New(pool.Config{Backends: backends})
+		if err != nil {
+			return ctrl, config, fmt.Errorf("failed to create wallet pool: %w", err)
+		}
+	}
+
+	var confirmations []gateway.ConfirmationTier
+	for _, tier := range c.Confirmations {
+		confirmations = append(confirmations, gateway.ConfirmationTier{
+			MaxAmount:     tier.MaxAmount.ToUint64(),
+			Confirmations: tier.Confirmations,
+		})
 	}
 
 	config = gateway.Config{
-		MinAmount:     c.MinAmount.ToUint64(),
-		MaxAmount:     c.MaxAmount.ToUint64(),
-		Timeout:       c.Timeout,
-		FeePercentage: c.FeePercentage,
-		Address:       c.BeneficiaryAddress,
-		Wallet: monero.New(monero.Config{
-			Accounts: true,
-			Client:   moneroClient,
-		}),
+		MinAmount:         c.MinAmount.ToUint64(),
+		MaxAmount:         c.MaxAmount.ToUint64(),
+		Timeout:           c.Timeout,
+		FeePercentage:     c.FeePercentage,
+		Address:           c.BeneficiaryAddress,
+		RecycleQuarantine: c.RecycleQuarantine,
+		LateDepositPolicy: lateDepositPolicy,
+		SingleTransaction: c.SingleTransaction,
+		ViewOnly:          c.ViewOnly,
+		Confirmations:     confirmations,
+		Oracle:            oracle,
+		IdempotencyWindow: c.IdempotencyWindow,
+		Metrics:           m,
+		Logger:            logger,
+		Retry: gateway.RetryConfig{
+			MaxAttempts: c.Retry.MaxAttempts,
+			Backoff:     c.Retry.Backoff,
+			MaxBackoff:  c.Retry.MaxBackoff,
+		},
+		Refund: gateway.RefundPolicy{
+			Underpaid: c.Refund.Underpaid,
+			Overpaid:  c.Refund.Overpaid,
+		},
+		Wallet: wallet,
+		Webhook: gateway.WebhookConfig{
+			Secret:               c.Webhook.Secret,
+			MaxAttempts:          c.Webhook.MaxAttempts,
+			Backoff:              c.Webhook.Backoff,
+			MaxBackoff:           c.Webhook.MaxBackoff,
+			Timeout:              c.Webhook.Timeout,
+			AllowPrivateNetworks: c.Webhook.AllowPrivateNetworks,
+			Payload: func(p *gateway.Payment) (body []byte, err error) {
+				out := router.PaymentFromGateway(p)
+				return json.Marshal(&out)
+			},
+		},
 	}
 
 	config.DB, err = badger.Open(opt)
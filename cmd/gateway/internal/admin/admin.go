@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RogueTeam/8ball/cmd/gateway/internal/router"
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	IdParam            = "id"
+	PaymentsPath       = "/payments"
+	PaymentsPathWithId = PaymentsPath + "/:" + IdParam
+	RetryPath          = PaymentsPathWithId + "/retry"
+	CancelPath         = PaymentsPathWithId + "/cancel"
+	BalancesPath       = "/balances"
+	SigningPath        = "/signing"
+	MetricsPath        = "/metrics"
+)
+
+const (
+	// Query parameter filtering the payments by the status of any leg
+	StatusQuery = "status"
+	// Query parameter filtering the payments of a merchant
+	MerchantQuery = "merchant"
+)
+
+// Operator API exposing the raw state of the gateway. Intended to be served on a private listener
+type Admin struct {
+	// Gateway controller
+	Gateway *gateway.Controller
+	// Base Gin Group to use for routing
+	Base gin.IRoutes
+	// Credentials required through HTTP basic authentication
+	Username string
+	Password string
+	// Prometheus handler served at MetricsPath. Disabled when nil
+	Metrics http.Handler
+}
+
+func parseId(ctx *gin.Context) (id uuid.UUID, err error) {
+	return uuid.Parse(ctx.Param(IdParam))
+}
+
+// Translates controller errors into status codes
+func abort(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gateway.ErrPaymentNotFound):
+		ctx.AbortWithError(http.StatusNotFound, err)
+	case errors.Is(err, gateway.ErrInvalidListRequest):
+		ctx.AbortWithError(http.StatusBadRequest, err)
+	case errors.Is(err, gateway.ErrNotCancelable),
+		errors.Is(err, gateway.ErrNothingToRetry),
+		errors.Is(err, gateway.ErrNotAwaitingSignature):
+		ctx.AbortWithError(http.StatusConflict, err)
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// Accepts the filters of the public listing plus the status of any leg and the merchant
+func (a *Admin) listPayments(ctx *gin.Context) {
+	req, err := router.ParseListRequest(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	req.Status = gateway.Status(ctx.Query(StatusQuery))
+
+	if raw := ctx.Query(MerchantQuery); raw != "" {
+		merchant, err := uuid.Parse(raw)
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		req.Merchant = &merchant
+	}
+
+	res, err := a.Gateway.List(ctx, req)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	if res.Payments == nil {
+		res.Payments = []gateway.Payment{}
+	}
+	ctx.JSON(http.StatusOK, &res)
+}
+
+func (a *Admin) viewPayment(ctx *gin.Context) {
+	id, err := parseId(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	payment, err := a.Gateway.Query(ctx, id)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &payment)
+}
+
+func (a *Admin) retryPayment(ctx *gin.Context) {
+	id, err := parseId(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	payment, err := a.Gateway.Retry(ctx, id)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &payment)
+}
+
+func (a *Admin) cancelPayment(ctx *gin.Context) {
+	id, err := parseId(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	payment, err := a.Gateway.Cancel(ctx, id)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &payment)
+}
+
+func (a *Admin) balances(ctx *gin.Context) {
+	balances, err := a.Gateway.Balances(ctx)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, balances)
+}
+
+// Response of the submission of a signed batch
+type Submitted struct {
+	// Transfers relayed by the request. Transfers submitted before are skipped
+	Submitted uint64 `json:"submitted"`
+}
+
+// Transfers waiting for the offline signature
+func (a *Admin) signing(ctx *gin.Context) {
+	batch, err := a.Gateway.Signing(ctx)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	if batch.Transfers == nil {
+		batch.Transfers = []gateway.UnsignedTransfer{}
+	}
+	ctx.JSON(http.StatusOK, &batch)
+}
+
+// Submits the transfers signed offline
+func (a *Admin) submit(ctx *gin.Context) {
+	var batch gateway.SignedBatch
+	err := ctx.BindJSON(&batch)
+	if err != nil {
+		return
+	}
+
+	submitted, err := a.Gateway.Submit(ctx, batch)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &Submitted{Submitted: submitted})
+}
+
+// Register routes in the Gin engine
+func (a *Admin) Register() {
+	auth := gin.BasicAuth(gin.Accounts{a.Username: a.Password})
+
+	a.Base.GET(PaymentsPath, auth, a.listPayments)
+	a.Base.GET(PaymentsPathWithId, auth, a.viewPayment)
+	a.Base.POST(RetryPath, auth, a.retryPayment)
+	a.Base.POST(CancelPath, auth, a.cancelPayment)
+	a.Base.GET(BalancesPath, auth, a.balances)
+	a.Base.GET(SigningPath, auth, a.signing)
+	a.Base.POST(SigningPath, auth, a.submit)
+	if a.Metrics != nil {
+		a.Base.GET(MetricsPath, auth, gin.WrapH(a.Metrics))
+	}
+}
@@ -0,0 +1,107 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+// Key holding the owner of the processing lease
+const LeaseKey = "/lease/processing"
+
+// Time the lease survives without being renewed
+const DefaultLeaseTTL = time.Minute
+
+// Exclusive right to process the payments of a database. Only the instance holding it runs
+// the processing loops so two gateways sharing the database never process the same payment.
+//
+// Badger locks its directory with the default options, so two gateway processes never open the
+// same database at once. The lease arbitrates between processors sharing an opened *badger.DB and
+// between processes where that lock doesn't hold: databases opened with BypassLockGuard or stored
+// on filesystems without working flock, like some network volumes. It also makes the replacement
+// of a crashed instance wait for the TTL before processing its payments
+type Lease struct {
+	// Database shared by the instances
+	DB *badger.DB
+	// Identifier of this instance
+	Owner uuid.UUID
+	// Time the lease survives without being renewed. Defaults to DefaultLeaseTTL
+	TTL time.Duration
+}
+
+func (l *Lease) ttl() (ttl time.Duration) {
+	if l.TTL == 0 {
+		return DefaultLeaseTTL
+	}
+	return l.TTL
+}
+
+// Takes or renews the lease. Reports false while other instance holds it
+func (l *Lease) Acquire() (acquired bool, err error) {
+	err = l.DB.Update(func(txn *badger.Txn) (err error) {
+		owner, err := l.owner(txn)
+		if err != nil {
+			return err
+		}
+		if owner != uuid.Nil && owner != l.Owner {
+			return nil
+		}
+
+		err = txn.SetEntry(badger.NewEntry([]byte(LeaseKey), l.Owner[:]).WithTTL(l.ttl()))
+		if err != nil {
+			return fmt.Errorf("failed to set lease: %w", err)
+		}
+		acquired = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return acquired, nil
+}
+
+// Gives up the lease so other instance can take it without waiting for its expiration
+func (l *Lease) Release() (err error) {
+	err = l.DB.Update(func(txn *badger.Txn) (err error) {
+		owner, err := l.owner(txn)
+		if err != nil {
+			return err
+		}
+		if owner != l.Owner {
+			return nil
+		}
+
+		err = txn.Delete([]byte(LeaseKey))
+		if err != nil {
+			return fmt.Errorf("failed to delete lease: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+// Current holder of the lease. Nil when nobody holds it
+func (l *Lease) owner(txn *badger.Txn) (owner uuid.UUID, err error) {
+	item, err := txn.Get([]byte(LeaseKey))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return owner, fmt.Errorf("failed to retrieve lease: %w", err)
+	}
+
+	err = item.Value(func(val []byte) (err error) {
+		owner, err = uuid.FromBytes(val)
+		return err
+	})
+	if err != nil {
+		return owner, fmt.Errorf("failed to parse lease owner: %w", err)
+	}
+	return owner, nil
+}
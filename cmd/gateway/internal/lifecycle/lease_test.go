@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Lease(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (db *badger.DB) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	t.Run("Acquire", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		db := setup(t)
+		first := Lease{DB: db, Owner: uuid.New()}
+		second := Lease{DB: db, Owner: uuid.New()}
+
+		acquired, err := first.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "free lease should be acquired")
+
+		acquired, err = first.Acquire()
+		assertions.Nil(err, "failed to renew lease")
+		assertions.True(acquired, "holder should renew the lease")
+
+		acquired, err = second.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.False(acquired, "held lease can't be acquired")
+	})
+	t.Run("Release", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		db := setup(t)
+		first := Lease{DB: db, Owner: uuid.New()}
+		second := Lease{DB: db, Owner: uuid.New()}
+
+		acquired, err := first.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "free lease should be acquired")
+
+		assertions.Nil(second.Release(), "failed to release lease")
+		acquired, err = second.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.False(acquired, "only the holder can release the lease")
+
+		assertions.Nil(first.Release(), "failed to release lease")
+		acquired, err = second.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "released lease should be acquired")
+	})
+	t.Run("Expiration", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		db := setup(t)
+		crashed := Lease{DB: db, Owner: uuid.New(), TTL: time.Second}
+		standby := Lease{DB: db, Owner: uuid.New(), TTL: time.Second}
+
+		acquired, err := crashed.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "free lease should be acquired")
+
+		// Badger expires the keys with a precision of seconds
+		time.Sleep(2 * time.Second)
+		acquired, err = standby.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "expired lease should be taken over")
+
+		acquired, err = crashed.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.False(acquired, "previous holder can't take the lease back")
+	})
+	t.Run("Lost", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		db := setup(t)
+		p := Processor{
+			Lease:  &Lease{DB: db, Owner: uuid.New(), TTL: 300 * time.Millisecond},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+		other := Lease{DB: db, Owner: uuid.New()}
+
+		acquired, err := other.Acquire()
+		assertions.Nil(err, "failed to acquire lease")
+		assertions.True(acquired, "free lease should be acquired")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		defer close(done)
+		go p.renew(done, cancel)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			assertions.Fail("iteration should be canceled once the lease is lost")
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/logging"
+)
+
+// Owns the processing loops of the gateway and the processing of the wallet events. Every
+// iteration runs to completion so stopping never leaves a payment half-updated
+type Processor struct {
+	// Gateway controller
+	Gateway *gateway.Controller
+	// Lease required to process
+	Lease *Lease
+	// Interval between processing iterations
+	ProcessInterval time.Duration
+	// Interval between scans for late deposits. Disabled when zero
+	OrphanScanInterval time.Duration
+	// Logger of the processing loops
+	Logger *slog.Logger
+}
+
+// Processes the payments until the context is canceled. Returns once the in-flight
+// iteration finishes and the lease was released
+func (p *Processor) Run(ctx context.Context) {
+	defer func() {
+		err := p.Lease.Release()
+		if err != nil {
+			p.Logger.Error("failed to release lease", logging.KeyError, err)
+		}
+	}()
+
+	// Wallet events are only processed by the lease holder
+	var w *watcher
+	defer func() {
+		if w != nil {
+			w.stop()
+		}
+	}()
+
+	ticker := time.NewTicker(p.ProcessInterval)
+	defer ticker.Stop()
+
+	var recovered bool
+	var nextOrphanScan time.Time
+	for {
+		acquired, err := p.Lease.Acquire()
+		switch {
+		case err != nil:
+			p.Logger.Error("failed to acquire lease", logging.KeyError, err)
+		case !acquired:
+			p.Logger.Debug("lease held by other instance")
+			// The holder may crash leaving intents behind
+			recovered = false
+			if w != nil {
+				w.stop()
+				w = nil
+			}
+		case !recovered:
+			// Transfers interrupted by a crash are reconciled before anything is processed
+			recovered = p.recover(ctx)
+			if !recovered {
+				break
+			}
+			fallthrough
+		default:
+			if w == nil {
+				w = p.watch(ctx)
+			}
+			scanOrphans := p.OrphanScanInterval > 0 && !time.Now().Before(nextOrphanScan)
+			if scanOrphans {
+				nextOrphanScan = time.Now().Add(p.OrphanScanInterval)
+			}
+			p.process(ctx, scanOrphans)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs a single iteration of every loop while keeping the lease alive. Stopping the processor
+// doesn't interrupt the iteration, only losing the lease cancels it
+func (p *Processor) process(ctx context.Context, scanOrphans bool) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go p.renew(done, cancel)
+
+	loops := map[string]func(context.Context) (uint64, error){
+		"payments": p.Gateway.ProcessPendingPayments,
+		"fees":     p.Gateway.ProcessPendingFees,
+		"refunds":  p.Gateway.ProcessPendingRefunds,
+		"webhooks": p.Gateway.ProcessPendingWebhooks,
+	}
+	if scanOrphans {
+		loops["late-deposits"] = p.Gateway.ProcessLateDeposits
+	}
+
+	var wg sync.WaitGroup
+	for name, loop := range loops {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			processed, err := loop(ctx)
+			p.report(name, processed, err)
+		}()
+	}
+	wg.Wait()
+}
+
+// Processes the wallet events in the background
+type watcher struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Stops processing events and waits for the in-flight one
+func (w *watcher) stop() {
+	w.cancel()
+	<-w.done
+}
+
+// Processes the wallet events until stopped. Failed subscriptions are retried every ProcessInterval
+func (p *Processor) watch(ctx context.Context) (w *watcher) {
+	ctx, cancel := context.WithCancel(ctx)
+	w = &watcher{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(w.done)
+
+		for {
+			err := p.Gateway.Watch(ctx)
+			if errors.Is(err, gateway.ErrNotifierUnsupported) {
+				p.Logger.Debug("wallet events unsupported; polling only")
+				return
+			}
+			if err != nil {
+				p.Logger.Error("failed to watch wallet", logging.KeyError, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.ProcessInterval):
+			}
+		}
+	}()
+	return w
+}
+
+// Reconciles the transfer intents left by a previous holder of the lease. Reports false when
+// it must be retried
+func (p *Processor) recover(ctx context.Context) (recovered bool) {
+	count, err := p.Gateway.Recover(context.WithoutCancel(ctx))
+	if err != nil {
+		p.Logger.Error("failed to recover transfer intents", logging.KeyError, err)
+		return false
+	}
+	if count > 0 {
+		p.Logger.Warn("recovered interrupted transfers", "recovered", count)
+	}
+	return true
+}
+
+// Renews the lease until done is closed. Cancels the iteration when the lease is lost or can't be
+// renewed since other instance may take it once it expires
+func (p *Processor) renew(done chan struct{}, cancel context.CancelFunc) {
+	ticker := time.NewTicker(p.Lease.ttl() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			acquired, err := p.Lease.Acquire()
+			if err != nil {
+				p.Logger.Error("failed to renew lease", logging.KeyError, err)
+				cancel()
+				return
+			}
+			if !acquired {
+				p.Logger.Error("lease lost while processing")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// Logs the outcome of a processing loop
+func (p *Processor) report(loop string, processed uint64, err error) {
+	if err != nil {
+		p.Logger.Error("failed to process", "loop", loop, logging.KeyError, err)
+	}
+	if processed > 0 {
+		p.Logger.Info("processed", "loop", loop, "processed", processed)
+	} else {
+		p.Logger.Debug("processed", "loop", loop, "processed", processed)
+	}
+}
@@ -0,0 +1,92 @@
+package lifecycle
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Wallet whose transfers take a while and are aborted with their context
+type slowWallet struct {
+	wallets.Wallet
+	delay   time.Duration
+	started chan struct{}
+}
+
+func (w *slowWallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	close(w.started)
+	select {
+	case <-ctx.Done():
+		return transfer, ctx.Err()
+	case <-time.After(w.delay):
+	}
+	return w.Wallet.Transfer(ctx, req)
+}
+
+func Test_Processor(t *testing.T) {
+	t.Run("Shutdown", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+		if !assertions.Nil(err, "failed to open database") {
+			return
+		}
+		defer db.Close()
+
+		wallet := &slowWallet{Wallet: mock.New(mock.Config{}), delay: time.Second, started: make(chan struct{})}
+		ctrl := gateway.New(gateway.Config{DB: db, Wallet: wallet, MaxAmount: ^uint64(0), FeePercentage: 10})
+
+		payment, err := ctrl.Receive(context.TODO(), &gateway.Receive{
+			Address:  "mock_beneficiary",
+			Amount:   1_000_000,
+			Priority: wallets.PriorityHigh,
+		})
+		if !assertions.Nil(err, "failed to create payment") {
+			return
+		}
+		_, err = wallet.Wallet.Transfer(context.TODO(), wallets.TransferRequest{
+			SourceIndex: 0,
+			Destination: payment.Receiver.Address,
+			Amount:      payment.Amount,
+		})
+		if !assertions.Nil(err, "failed to transfer to receiver") {
+			return
+		}
+
+		p := Processor{
+			Gateway:         &ctrl,
+			Lease:           &Lease{DB: db, Owner: uuid.New()},
+			ProcessInterval: time.Hour,
+			Logger:          slog.New(slog.DiscardHandler),
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGUSR1)
+		defer stop()
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			p.Run(ctx)
+		}()
+
+		<-wallet.started
+		assertions.Nil(syscall.Kill(os.Getpid(), syscall.SIGUSR1), "failed to send signal")
+		<-stopped
+
+		payment, err = ctrl.Query(context.TODO(), payment.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusCompleted, payment.Beneficiary.Status, "in-flight transfer should complete: %s", payment.Beneficiary.Error)
+		assertions.NotEmpty(payment.Beneficiary.Transaction, "transaction should be recorded")
+	})
+}
@@ -0,0 +1,102 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/gin-gonic/gin"
+)
+
+// Query parameters of the payment listing
+const (
+	BeneficiaryStatusQuery = "beneficiaryStatus"
+	FeeStatusQuery         = "feeStatus"
+	RefundStatusQuery      = "refundStatus"
+	// RFC3339 creation range
+	CreatedFromQuery = "createdFrom"
+	CreatedToQuery   = "createdTo"
+	// RFC3339 expiration range
+	ExpirationFromQuery = "expirationFrom"
+	ExpirationToQuery   = "expirationTo"
+	AddressQuery        = "address"
+	// Amount range in XMR
+	MinAmountQuery = "minAmount"
+	MaxAmountQuery = "maxAmount"
+	LimitQuery     = "limit"
+	CursorQuery    = "cursor"
+)
+
+type PaymentsPage struct {
+	// Payments sorted by creation time
+	Payments []Payment `json:"payments"`
+	// Cursor of the next page. Missing in the last one
+	Next string `json:"next,omitzero"`
+}
+
+func queryTime(ctx *gin.Context, key string) (t time.Time, err error) {
+	raw := ctx.Query(key)
+	if raw == "" {
+		return t, nil
+	}
+	t, err = time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return t, nil
+}
+
+func queryAmount(ctx *gin.Context, key string) (amount uint64, err error) {
+	raw := ctx.Query(key)
+	if raw == "" {
+		return 0, nil
+	}
+	var d decimal.Decimal
+	err = d.FromString(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d.ToUint64(), nil
+}
+
+// ParseListRequest reads the filters of the payment listing from the query parameters
+func ParseListRequest(ctx *gin.Context) (req gateway.ListRequest, err error) {
+	req = gateway.ListRequest{
+		BeneficiaryStatus: gateway.Status(ctx.Query(BeneficiaryStatusQuery)),
+		FeeStatus:         gateway.Status(ctx.Query(FeeStatusQuery)),
+		RefundStatus:      gateway.Status(ctx.Query(RefundStatusQuery)),
+		Address:           ctx.Query(AddressQuery),
+		Cursor:            ctx.Query(CursorQuery),
+	}
+
+	for key, dst := range map[string]*time.Time{
+		CreatedFromQuery:    &req.From,
+		CreatedToQuery:      &req.To,
+		ExpirationFromQuery: &req.ExpirationFrom,
+		ExpirationToQuery:   &req.ExpirationTo,
+	} {
+		*dst, err = queryTime(ctx, key)
+		if err != nil {
+			return req, err
+		}
+	}
+
+	req.MinAmount, err = queryAmount(ctx, MinAmountQuery)
+	if err != nil {
+		return req, err
+	}
+	req.MaxAmount, err = queryAmount(ctx, MaxAmountQuery)
+	if err != nil {
+		return req, err
+	}
+
+	if raw := ctx.Query(LimitQuery); raw != "" {
+		req.Limit, err = strconv.Atoi(raw)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s: %w", LimitQuery, err)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// Header containing the API key of the merchant as "Bearer <key>"
+	AuthorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
+	// Gin context key of the authenticated merchant
+	merchantContextKey = "merchant"
+)
+
+var ErrApiKeyRequired = errors.New("api key required")
+
+// Middleware rejecting requests without a valid merchant API key
+func (r *Router) requireMerchant(ctx *gin.Context) {
+	header := ctx.GetHeader(AuthorizationHeader)
+	apiKey, found := strings.CutPrefix(header, bearerPrefix)
+	if !found || apiKey == "" {
+		ctx.AbortWithError(http.StatusUnauthorized, ErrApiKeyRequired)
+		return
+	}
+
+	merchant, err := r.Gateway.Authenticate(ctx, apiKey)
+	switch {
+	case err == nil:
+		ctx.Set(merchantContextKey, merchant.Id)
+		ctx.Next()
+	case errors.Is(err, gateway.ErrInvalidApiKey):
+		ctx.AbortWithError(http.StatusUnauthorized, err)
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
+
+// Returns the authenticated merchant of the request
+func merchantFromContext(ctx *gin.Context) (id uuid.UUID, found bool) {
+	value, found := ctx.Get(merchantContextKey)
+	if !found {
+		return uuid.Nil, false
+	}
+	id, found = value.(uuid.UUID)
+	return id, found
+}
+
+// Queries the payment restricting it to the authenticated merchant if any
+func (r *Router) query(ctx *gin.Context, id uuid.UUID) (payment gateway.Payment, err error) {
+	merchant, found := merchantFromContext(ctx)
+	if found {
+		return r.Gateway.QueryMerchant(ctx, merchant, id)
+	}
+	return r.Gateway.Query(ctx, id)
+}
@@ -0,0 +1,184 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/pow/hashcash"
+	"github.com/RogueTeam/8ball/random"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ChallengePath = "/challenge"
+	// Header containing the hashcash of the request
+	StampHeader = "X-Hashcash"
+	// Payload expected in the hashcash of payment creations
+	PaymentsResource = "payments"
+	// Tolerated difference between the clocks of the client and the server
+	MaxClockSkew = time.Minute
+	// Validity of challenges and stamps when not configured
+	DefaultPowExpiration = 10 * time.Minute
+)
+
+const (
+	challengePrefix = "/challenge/"
+	stampPrefix     = "/stamp/"
+)
+
+const saltLength = 32
+
+var (
+	ErrStampRequired     = errors.New("hashcash stamp required")
+	ErrInvalidStamp      = errors.New("invalid hashcash stamp")
+	ErrStampSpent        = errors.New("hashcash stamp already spent")
+	ErrUnknownSalt       = errors.New("unknown or expired challenge salt")
+	ErrStaleStamp        = errors.New("stale hashcash stamp")
+	ErrInsufficientStamp = errors.New("insufficient hashcash bits")
+)
+
+// Proof of work configuration. Disabled when Bits is zero
+type Pow struct {
+	// Bits required in the stamps
+	Bits uint64
+	// Time a challenge and its stamps remain valid
+	Expiration time.Duration
+}
+
+type Challenge struct {
+	// Salt to include in the stamp
+	Salt string `json:"salt"`
+	// Bits required
+	Bits uint64 `json:"bits"`
+	// Payload to include in the stamp
+	Resource string `json:"resource"`
+	// Expiration of the challenge
+	Expiration time.Time `json:"expiration"`
+}
+
+func challengeKey(salt string) (key []byte) {
+	return []byte(challengePrefix + salt)
+}
+
+func stampKey(stamp string) (key []byte) {
+	sum := sha256.Sum256([]byte(stamp))
+	return []byte(stampPrefix + hex.EncodeToString(sum[:]))
+}
+
+func (r *Router) createChallenge(ctx *gin.Context) {
+	challenge := Challenge{
+		Salt:       random.String(random.CryptoRand(), random.CharsetAlphaNumeric, saltLength),
+		Bits:       r.Pow.Bits,
+		Resource:   PaymentsResource,
+		Expiration: time.Now().Add(r.Pow.Expiration),
+	}
+
+	err := r.DB.Update(func(txn *badger.Txn) (err error) {
+		entry := badger.NewEntry(challengeKey(challenge.Salt), nil).WithTTL(r.Pow.Expiration)
+		return txn.SetEntry(entry)
+	})
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, fmt.Errorf("failed to save challenge: %w", err))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, &challenge)
+}
+
+// Verifies the stamp and marks it as spent. Stamps spent with an idempotency key are accepted again
+// with the same key so retries reach the replay of the payment
+func (r *Router) spendStamp(stamp string, idempotency []byte) (err error) {
+	parsed, err := hashcash.Parse(stamp)
+	if err != nil {
+		return errors.Join(ErrInvalidStamp, err)
+	}
+
+	if parsed.Payload != PaymentsResource {
+		return fmt.Errorf("%w: unexpected resource: %s", ErrInvalidStamp, parsed.Payload)
+	}
+
+	if parsed.Bits < r.Pow.Bits {
+		return fmt.Errorf("%w: expecting at least %d but got %d", ErrInsufficientStamp, r.Pow.Bits, parsed.Bits)
+	}
+
+	now := time.Now()
+	expiration := parsed.Date.Add(r.Pow.Expiration)
+	if now.After(expiration) || parsed.Date.After(now.Add(MaxClockSkew)) {
+		return ErrStaleStamp
+	}
+
+	err = hashcash.Verify(sha256.New(), stamp)
+	if err != nil {
+		return errors.Join(ErrInvalidStamp, err)
+	}
+
+	return r.DB.Update(func(txn *badger.Txn) (err error) {
+		key := stampKey(stamp)
+		item, err := txn.Get(key)
+		switch {
+		case err == nil:
+			spentWith, err := item.ValueCopy(nil)
+			if err != nil {
+				return fmt.Errorf("failed to query stamp: %w", err)
+			}
+			if idempotency != nil && bytes.Equal(spentWith, idempotency) {
+				return nil
+			}
+			return ErrStampSpent
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return fmt.Errorf("failed to query stamp: %w", err)
+		}
+
+		_, err = txn.Get(challengeKey(parsed.Salt))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrUnknownSalt
+			}
+			return fmt.Errorf("failed to query challenge: %w", err)
+		}
+
+		entry := badger.NewEntry(key, idempotency).WithTTL(time.Until(expiration))
+		err = txn.SetEntry(entry)
+		if err != nil {
+			return fmt.Errorf("failed to save spent stamp: %w", err)
+		}
+		return nil
+	})
+}
+
+// Middleware rejecting requests without a valid stamp
+func (r *Router) requireStamp(ctx *gin.Context) {
+	stamp := ctx.GetHeader(StampHeader)
+	if stamp == "" {
+		ctx.AbortWithError(http.StatusPreconditionRequired, ErrStampRequired)
+		return
+	}
+
+	// Scoped like the idempotency keys of the payments
+	var idempotency []byte
+	if key := ctx.GetHeader(IdempotencyKeyHeader); key != "" {
+		merchant, _ := merchantFromContext(ctx)
+		idempotency = gateway.IdempotencyKey(merchant, key)
+	}
+
+	err := r.spendStamp(stamp, idempotency)
+	switch {
+	case err == nil:
+		ctx.Next()
+	case errors.Is(err, ErrInvalidStamp),
+		errors.Is(err, ErrInsufficientStamp),
+		errors.Is(err, ErrStaleStamp),
+		errors.Is(err, ErrUnknownSalt),
+		errors.Is(err, ErrStampSpent):
+		ctx.AbortWithError(http.StatusForbidden, err)
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,144 @@
+package router
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/pow/hashcash"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const powBits = 8
+
+func Test_Pow(t *testing.T) {
+	t.Parallel()
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctrl := gateway.New(gateway.Config{
+		DB:        db,
+		Wallet:    mock.New(mock.Config{}),
+		MaxAmount: ^uint64(0),
+	})
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	r := Router{
+		Gateway: &ctrl,
+		Base:    engine,
+		DB:      db,
+		Pow:     Pow{Bits: powBits},
+	}
+	r.Register()
+
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+
+	challenge := func(t *testing.T) (c Challenge) {
+		res, err := http.Post(server.URL+ChallengePath, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		err = json.NewDecoder(res.Body).Decode(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	pay := func(t *testing.T, stamp, idempotencyKey string) (status int) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+PaymentsPath, strings.NewReader(`{"address":"mock_beneficiary","amount":"0.001"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(StampHeader, stamp)
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		c := challenge(t)
+		assertions.EqualValues(powBits, c.Bits, "invalid challenge bits")
+		assertions.Equal(PaymentsResource, c.Resource, "invalid challenge resource")
+
+		stamp, err := hashcash.New(context.TODO(), sha256.New(), powBits, c.Salt, c.Resource)
+		assertions.Nil(err, "failed to create stamp")
+		assertions.Equal(http.StatusCreated, pay(t, stamp, ""), "valid stamps should be accepted")
+	})
+	t.Run("Replayed", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		c := challenge(t)
+		stamp, err := hashcash.New(context.TODO(), sha256.New(), powBits, c.Salt, c.Resource)
+		assertions.Nil(err, "failed to create stamp")
+		assertions.Equal(http.StatusCreated, pay(t, stamp, ""), "valid stamps should be accepted")
+		assertions.Equal(http.StatusForbidden, pay(t, stamp, ""), "spent stamps should be rejected")
+	})
+	t.Run("Idempotent", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		c := challenge(t)
+		stamp, err := hashcash.New(context.TODO(), sha256.New(), powBits, c.Salt, c.Resource)
+		assertions.Nil(err, "failed to create stamp")
+		assertions.Equal(http.StatusCreated, pay(t, stamp, "retry"), "valid stamps should be accepted")
+		assertions.Equal(http.StatusCreated, pay(t, stamp, "retry"), "retries should replay the payment")
+		assertions.Equal(http.StatusForbidden, pay(t, stamp, "other"), "stamps are bound to their idempotency key")
+		assertions.Equal(http.StatusForbidden, pay(t, stamp, ""), "spent stamps should be rejected")
+	})
+	t.Run("Expired", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		c := challenge(t)
+		date := time.Now().UTC().Add(-2 * DefaultPowExpiration)
+		stamp := fmt.Sprintf("1:%d:%s::%s:%s:AA==", powBits, date.Format(hashcash.DateFormat), c.Resource, c.Salt)
+		assertions.Equal(http.StatusForbidden, pay(t, stamp, ""), "expired stamps should be rejected")
+		assertions.ErrorIs(r.spendStamp(stamp, nil), ErrStaleStamp, "stamp should be stale")
+	})
+	t.Run("Insufficient", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		c := challenge(t)
+		stamp, err := hashcash.New(context.TODO(), sha256.New(), powBits/2, c.Salt, c.Resource)
+		assertions.Nil(err, "failed to create stamp")
+		assertions.Equal(http.StatusForbidden, pay(t, stamp, ""), "stamps with too few bits should be rejected")
+		assertions.ErrorIs(r.spendStamp(stamp, nil), ErrInsufficientStamp, "stamp should be insufficient")
+	})
+	t.Run("Missing", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		assertions.Equal(http.StatusPreconditionRequired, pay(t, "", ""), "stamps should be required")
+	})
+}
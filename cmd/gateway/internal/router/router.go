@@ -2,32 +2,45 @@ package router
 
 import (
 	"errors"
-	"log"
+	"io"
 	"net/http"
-	"sync"
-	"time"
 
 	"github.com/RogueTeam/8ball/gateway"
+	badger "github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 // Manages the entire setup of the Gateway service
 type Router struct {
-	// Process interval
-	ProcessInterval time.Duration
 	// Gateway controller
 	Gateway *gateway.Controller
 	// Base Gin Group to use for routing
 	Base gin.IRoutes
+	// Database used for the challenges and spent stamps
+	DB *badger.DB
+	// Proof of work required to create payments
+	Pow Pow
+	// Requires a merchant API key on every payment endpoint
+	RequireApiKey bool
 }
 
 const (
 	IdParam            = "id"
 	PaymentsPath       = "/payments"
 	PaymentsPathWithId = PaymentsPath + "/:" + IdParam
+	EventsPath         = PaymentsPathWithId + "/events"
 )
 
+// Name of the Server-Sent Events carrying the payment state
+const PaymentEvent = "payment"
+
+// Query parameter finding the payments of an order
+const OrderIdQuery = "orderId"
+
+// Header making retries of a payment creation return the original payment
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 func (r *Router) createPayment(ctx *gin.Context) {
 	var receive Receive
 	err := ctx.BindJSON(&receive)
@@ -41,12 +54,16 @@ func (r *Router) createPayment(ctx *gin.Context) {
 		ctx.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
+	gatewayReceive.Merchant, _ = merchantFromContext(ctx)
+	gatewayReceive.IdempotencyKey = ctx.GetHeader(IdempotencyKeyHeader)
 
 	payment, err := r.Gateway.Receive(ctx, &gatewayReceive)
 	switch {
 	case err == nil:
 		out := PaymentFromGateway(&payment)
 		ctx.JSON(http.StatusCreated, &out)
+	case errors.Is(err, gateway.ErrIdempotencyMismatch):
+		ctx.AbortWithError(http.StatusUnprocessableEntity, err)
 	default:
 		ctx.AbortWithError(http.StatusInternalServerError, err)
 	}
@@ -60,7 +77,7 @@ func (r *Router) paymentStatus(ctx *gin.Context) {
 		return
 	}
 
-	payment, err := r.Gateway.Query(ctx, id)
+	payment, err := r.query(ctx, id)
 	switch {
 	case err == nil:
 		out := PaymentFromGateway(&payment)
@@ -72,37 +89,124 @@ func (r *Router) paymentStatus(ctx *gin.Context) {
 	}
 }
 
+// Lists the payments of the authenticated merchant or the ones created for an order
+func (r *Router) findPayments(ctx *gin.Context) {
+	merchant, authenticated := merchantFromContext(ctx)
+
+	orderId := ctx.Query(OrderIdQuery)
+	if orderId == "" {
+		r.listPayments(ctx, merchant, authenticated)
+		return
+	}
+
+	payments, err := r.Gateway.FindByOrder(ctx, merchant, orderId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	out := make([]Payment, 0, len(payments))
+	for _, payment := range payments {
+		out = append(out, PaymentFromGateway(&payment))
+	}
+	ctx.JSON(http.StatusOK, out)
+}
+
+func (r *Router) listPayments(ctx *gin.Context, merchant uuid.UUID, authenticated bool) {
+	// Without merchants every payment would be listed to anyone
+	if !authenticated {
+		ctx.AbortWithError(http.StatusUnauthorized, ErrApiKeyRequired)
+		return
+	}
+
+	req, err := ParseListRequest(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	req.Merchant = &merchant
+
+	res, err := r.Gateway.List(ctx, req)
+	switch {
+	case err == nil:
+	case errors.Is(err, gateway.ErrInvalidListRequest):
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	out := PaymentsPage{
+		Payments: make([]Payment, 0, len(res.Payments)),
+		Next:     res.Next,
+	}
+	for _, payment := range res.Payments {
+		out.Payments = append(out.Payments, PaymentFromGateway(&payment))
+	}
+	ctx.JSON(http.StatusOK, &out)
+}
+
+// Streams the payment state every time it changes. The current state is sent first
+func (r *Router) paymentEvents(ctx *gin.Context) {
+	rawId := ctx.Param(IdParam)
+	id, err := uuid.Parse(rawId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+
+	// Subscribing before querying ensures no state is lost in between
+	events, cancel := r.Gateway.Subscribe(id)
+	defer cancel()
+
+	payment, err := r.query(ctx, id)
+	switch {
+	case err == nil:
+	case errors.Is(err, gateway.ErrPaymentNotFound):
+		ctx.AbortWithError(http.StatusNotFound, err)
+		return
+	default:
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	out := PaymentFromGateway(&payment)
+	ctx.SSEvent(PaymentEvent, &out)
+	ctx.Writer.Flush()
+
+	ctx.Stream(func(w io.Writer) (keepOpen bool) {
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case payment, ok := <-events:
+			if !ok {
+				return false
+			}
+			out := PaymentFromGateway(&payment)
+			ctx.SSEvent(PaymentEvent, &out)
+			return true
+		}
+	})
+}
+
 // Register routes in the Gin engine
 func (r *Router) Register() {
-	r.Base.POST(PaymentsPath, r.createPayment)
-	r.Base.GET(PaymentsPathWithId, r.paymentStatus)
-
-	go func() {
-		ticker := time.NewTicker(r.ProcessInterval)
-		defer ticker.Stop()
-
-		for {
-			var wg sync.WaitGroup
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				processed, err := r.Gateway.ProcessPendingPayments()
-				if err != nil {
-					log.Println("ERROR|PROCESSING|PAYMENTS", err)
-				}
-				log.Println("INFO|PROCESSED|PAYMENTS", processed)
-			}()
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				processed, err := r.Gateway.ProcessPendingFees()
-				if err != nil {
-					log.Println("ERROR|PROCESSING|FEES", err)
-				}
-				log.Println("INFO|PROCESSED|FEES", processed)
-			}()
-			wg.Wait()
-			<-ticker.C
+	var auth []gin.HandlerFunc
+	if r.RequireApiKey {
+		auth = append(auth, r.requireMerchant)
+	}
+
+	if r.Pow.Bits > 0 {
+		if r.Pow.Expiration == 0 {
+			r.Pow.Expiration = DefaultPowExpiration
 		}
-	}()
+		r.Base.POST(ChallengePath, r.createChallenge)
+		r.Base.POST(PaymentsPath, append(auth, r.requireStamp, r.createPayment)...)
+	} else {
+		r.Base.POST(PaymentsPath, append(auth, r.createPayment)...)
+	}
+	r.Base.GET(PaymentsPath, append(auth, r.findPayments)...)
+	r.Base.GET(PaymentsPathWithId, append(auth, r.paymentStatus)...)
+	r.Base.GET(EventsPath, append(auth, r.paymentEvents)...)
 }
@@ -12,15 +12,34 @@ import (
 const DefaultPriority = wallets.PriorityLow
 
 type Receive struct {
-	Address string          `json:"address,omitzero"`
-	Amount  decimal.Decimal `json:"amount,omitzero"`
+	Address string `json:"address,omitzero"`
+	// Amount in XMR, or in Currency when set
+	Amount      decimal.Decimal `json:"amount,omitzero"`
+	CallbackUrl string          `json:"callbackUrl,omitzero"`
+	// Optional currency the amount is expressed in. Converted to XMR with the current exchange rate
+	Currency string `json:"currency,omitzero"`
+	// Address receiving the funds returned to the payer
+	RefundAddress string `json:"refundAddress,omitzero"`
+	// Reference of the payment in the order system of the merchant
+	OrderId string `json:"orderId,omitzero"`
+	// Free-form data stored with the payment
+	Metadata map[string]string `json:"metadata,omitzero"`
 }
 
 func ReceiveToGateway(src *Receive) (out gateway.Receive, err error) {
 	out = gateway.Receive{
-		Address:  src.Address,
-		Amount:   src.Amount.ToUint64(),
-		Priority: DefaultPriority,
+		Address:       src.Address,
+		Priority:      DefaultPriority,
+		CallbackUrl:   src.CallbackUrl,
+		RefundAddress: src.RefundAddress,
+		OrderId:       src.OrderId,
+		Metadata:      src.Metadata,
+	}
+	if src.Currency != "" {
+		out.Currency = src.Currency
+		out.Price = src.Amount
+	} else {
+		out.Amount = src.Amount.ToUint64()
 	}
 	return out, nil
 }
@@ -33,6 +52,8 @@ type (
 		Percentage uint64 `json:"percentage"`
 		// Error message
 		Error string `json:"error,omitzero"`
+		// Failed attempts
+		Attempts uint64 `json:"attempts,omitzero"`
 		// Actual amount payed to the account
 		Payed decimal.Decimal `json:"payed,omitzero"`
 	}
@@ -41,22 +62,74 @@ type (
 		Status gateway.Status `json:"status"`
 		// Error message
 		Error string `json:"error,omitzero"`
+		// Failed attempts
+		Attempts uint64 `json:"attempts,omitzero"`
 		// Actual amount payed to the Beneficiary
 		Payed decimal.Decimal `json:"payed,omitzero"`
 	}
+	Refund struct {
+		// Status of the refund
+		Status gateway.Status `json:"status"`
+		// Error message
+		Error string `json:"error,omitzero"`
+		// Amount to return
+		Amount decimal.Decimal `json:"amount"`
+		// Actual amount returned to the payer
+		Payed decimal.Decimal `json:"payed,omitzero"`
+	}
+	Quote struct {
+		// Currency the payment was priced in
+		Currency string `json:"currency"`
+		// Price of the payment expressed in the currency
+		Amount decimal.Decimal `json:"amount"`
+		// Price of a single XMR in the currency
+		Rate decimal.Decimal `json:"rate"`
+		// The rate is honored until this moment
+		Expiration time.Time `json:"expiration"`
+	}
+	Seen struct {
+		// Amount of the transfers seen in the pool
+		Amount decimal.Decimal `json:"amount"`
+		// Transactions seen in the pool
+		Transactions []string `json:"transactions"`
+	}
+	LateDeposit struct {
+		// Amount received after the payment was finalized
+		Amount decimal.Decimal `json:"amount"`
+		// Moment the deposit was detected
+		Detected time.Time `json:"detected"`
+		// Action taken over the funds
+		Action gateway.LateDepositPolicy `json:"action"`
+		// Status of the action
+		Status gateway.Status `json:"status"`
+		// Amount forwarded or refunded
+		Payed decimal.Decimal `json:"payed,omitzero"`
+	}
 	Payment struct {
 		// Identifier of the transaction
 		Id uuid.UUID `json:"id"`
+		// Reference of the payment in the order system of the merchant
+		OrderId string `json:"orderId,omitzero"`
+		// Free-form data stored with the payment
+		Metadata map[string]string `json:"metadata,omitzero"`
 		// Overall amount to expect from the transaction
 		Amount decimal.Decimal `json:"amount"`
 		// Expiration time of the payment
 		Expiration time.Time `json:"expiration"`
+		// Exchange rate used when the payment was priced in other currency
+		Quote *Quote `json:"quote,omitempty"`
 		// The receiver is the address used to receive the payment
 		PaymentAddress string `json:"paymentAddress"`
 		// Fee details
 		Fee Fee `json:"fee"`
 		// Beneficiary information. Stored in case wallet changes
 		Beneficiary Beneficiary `json:"beneficiary"`
+		// Funds returned to the payer
+		Refund Refund `json:"refund,omitzero"`
+		// Transfers detected before being mined
+		Seen Seen `json:"seen,omitzero"`
+		// Funds received after the payment was finalized
+		LateDeposits []LateDeposit `json:"lateDeposits,omitzero"`
 	}
 )
 
@@ -65,20 +138,54 @@ type (
 func PaymentFromGateway(src *gateway.Payment) (payment Payment) {
 	payment = Payment{
 		Id:             src.Id,
+		OrderId:        src.OrderId,
+		Metadata:       src.Metadata,
 		Expiration:     src.Expiration,
 		PaymentAddress: src.Receiver.Address,
 		Fee: Fee{
 			Status:     src.Fee.Status,
 			Error:      src.Fee.Error,
+			Attempts:   src.Fee.Attempts,
 			Percentage: src.Fee.Percentage,
 		},
 		Beneficiary: Beneficiary{
-			Status: src.Beneficiary.Status,
-			Error:  src.Beneficiary.Error,
+			Status:   src.Beneficiary.Status,
+			Error:    src.Beneficiary.Error,
+			Attempts: src.Beneficiary.Attempts,
 		},
 	}
 	payment.Amount.FromUint64(src.Amount)
 	payment.Fee.Payed.FromUint64(src.Fee.Payed)
 	payment.Beneficiary.Payed.FromUint64(src.Beneficiary.Payed)
+	if src.Refund.Status != "" {
+		payment.Refund = Refund{
+			Status: src.Refund.Status,
+			Error:  src.Refund.Error,
+		}
+		payment.Refund.Amount.FromUint64(src.Refund.Amount)
+		payment.Refund.Payed.FromUint64(src.Refund.Payed)
+	}
+	if src.Quote != nil {
+		payment.Quote = &Quote{
+			Currency:   src.Quote.Currency,
+			Amount:     src.Quote.Amount,
+			Rate:       src.Quote.Rate,
+			Expiration: src.Quote.Expiration,
+		}
+	}
+	if len(src.Seen.Transactions) > 0 {
+		payment.Seen.Transactions = src.Seen.Transactions
+		payment.Seen.Amount.FromUint64(src.Seen.Amount)
+	}
+	for _, deposit := range src.LateDeposits {
+		out := LateDeposit{
+			Detected: deposit.Detected,
+			Action:   deposit.Action,
+			Status:   deposit.Status,
+		}
+		out.Amount.FromUint64(deposit.Amount)
+		out.Payed.FromUint64(deposit.Payed)
+		payment.LateDeposits = append(payment.LateDeposits, out)
+	}
 	return payment
 }
@@ -1,24 +1,46 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/RogueTeam/8ball/cmd/gateway/internal/admin"
+	"github.com/RogueTeam/8ball/cmd/gateway/internal/lifecycle"
 	"github.com/RogueTeam/8ball/cmd/gateway/internal/router"
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/metrics"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gopkg.in/yaml.v3"
 )
 
+// Time the servers have to finish the in-flight requests once a shutdown signal arrives
+const DefaultShutdownTimeout = 30 * time.Second
+
 var app struct {
-	debug  bool
-	config string
+	debug       bool
+	config      string
+	newMerchant string
 }
 
 func init() {
 	flagset := flag.NewFlagSet("gatewat", flag.ExitOnError)
 	flagset.BoolVar(&app.debug, "debug", false, "set debug mode")
 	flagset.StringVar(&app.config, "config", "config.yaml", "YAML configuration")
+	flagset.StringVar(&app.newMerchant, "new-merchant", "", "YAML merchant settings. Registers the merchant, prints its API key and exits")
 	err := flagset.Parse(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
@@ -43,22 +65,156 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ctrl, config, err := cfg.Compile()
+	logger, err := cfg.Log.Compile()
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	var registry *prometheus.Registry
+	var m *metrics.Metrics
+	if cfg.Metrics {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		m = metrics.New(registry)
+	}
+
+	ctrl, config, err := cfg.Compile(m, logger)
+	if err != nil {
+		fatal(logger, "failed to compile configuration", err)
+	}
 	defer config.DB.Close()
 
+	indexed, err := ctrl.Reindex()
+	if err != nil {
+		fatal(logger, "failed to index payments", err)
+	}
+	if indexed > 0 {
+		logger.Info("indexed payments", "indexed", indexed)
+	}
+
+	if app.newMerchant != "" {
+		err = newMerchant(&ctrl, app.newMerchant)
+		if err != nil {
+			fatal(logger, "failed to create merchant", err)
+		}
+		return
+	}
+
 	e := gin.Default()
 	var r = router.Router{
-		ProcessInterval: cfg.ProcessInterval,
-		Gateway:         &ctrl,
-		Base:            e,
+		Gateway: &ctrl,
+		Base:    e,
+		DB:      config.DB,
+		Pow: router.Pow{
+			Bits:       cfg.Pow.Bits,
+			Expiration: cfg.Pow.Expiration,
+		},
+		RequireApiKey: cfg.RequireApiKey,
 	}
 	r.Register()
 
-	err = e.Run(cfg.ListenAddress)
+	servers := []*http.Server{{Addr: cfg.ListenAddress, Handler: e}}
+	if cfg.Metrics && cfg.Admin.ListenAddress == "" {
+		fatal(logger, "invalid metrics configuration", errors.New("metrics are served by the admin listener"))
+	}
+	if cfg.Admin.ListenAddress != "" {
+		if cfg.Admin.Username == "" || cfg.Admin.Password == "" {
+			fatal(logger, "invalid admin configuration", errors.New("admin username and password are required"))
+		}
+
+		adminEngine := gin.Default()
+		var a = admin.Admin{
+			Gateway:  &ctrl,
+			Base:     adminEngine,
+			Username: cfg.Admin.Username,
+			Password: cfg.Admin.Password,
+		}
+		if registry != nil {
+			a.Metrics = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		}
+		a.Register()
+
+		servers = append(servers, &http.Server{Addr: cfg.Admin.ListenAddress, Handler: adminEngine})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, server := range servers {
+		go func() {
+			err := server.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("failed to serve", "listen", server.Addr, logging.KeyError, err)
+				stop()
+			}
+		}()
+	}
+
+	var processor = lifecycle.Processor{
+		Gateway: &ctrl,
+		Lease: &lifecycle.Lease{
+			DB:    config.DB,
+			Owner: uuid.New(),
+			TTL:   cfg.LeaseTTL,
+		},
+		ProcessInterval:    cfg.ProcessInterval,
+		OrphanScanInterval: cfg.OrphanScanInterval,
+		Logger:             logger,
+	}
+	processing := make(chan struct{})
+	go func() {
+		defer close(processing)
+		processor.Run(ctx)
+	}()
+
+	<-ctx.Done()
+	logger.Info("shutting down")
+
+	shutdownTimeout := cfg.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Error("failed to shutdown server", "listen", server.Addr, logging.KeyError, err)
+		}
+	}
+
+	// The database is closed only after the in-flight payments were saved
+	<-processing
+	logger.Info("stopped")
+}
+
+// Logs the error and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, logging.KeyError, err)
+	os.Exit(1)
+}
+
+func newMerchant(ctrl *gateway.Controller, filename string) (err error) {
+	contents, err := os.ReadFile(filename)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to read merchant: %w", err)
+	}
+
+	var m Merchant
+	err = yaml.Unmarshal(contents, &m)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal merchant: %w", err)
 	}
+
+	merchant, apiKey, err := ctrl.NewMerchant(context.TODO(), m.Compile())
+	if err != nil {
+		return fmt.Errorf("failed to create merchant: %w", err)
+	}
+
+	fmt.Println("Merchant:", merchant.Id)
+	fmt.Println("API key:", apiKey)
+	return nil
 }
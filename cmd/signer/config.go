@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
+	"github.com/gabstv/httpdigest"
+)
+
+type (
+	// Offline wallet holding the spend key of the view-only wallet used by the gateway
+	Wallet struct {
+		Filename    string  `yaml:"filename"`
+		Password    string  `yaml:"password"`
+		RpcUrl      string  `yaml:"rpc-url"`
+		RpcUsername *string `yaml:"rpc-username,omitempty"`
+		RpcPassword *string `yaml:"rpc-password,omitempty"`
+	}
+	Config struct {
+		Wallet Wallet `yaml:"wallet"`
+		// Beneficiary and fee addresses the signer is allowed to pay. Transfers to any other
+		// address, like the refunds to the payers, are confirmed one by one by the operator
+		AllowedAddresses []string `yaml:"allowed-addresses"`
+	}
+)
+
+// Client of the wallet-rpc serving the offline wallet
+func (w *Wallet) Compile() (client *rpc.Client) {
+	var httpClient http.Client
+	if w.RpcUsername != nil && w.RpcPassword != nil {
+		httpClient.Transport = httpdigest.New(*w.RpcUsername, *w.RpcPassword)
+	}
+
+	return rpc.New(rpc.Config{
+		Url:    w.RpcUrl,
+		Client: &httpClient,
+	})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
+	"github.com/RogueTeam/8ball/wallets"
+	"gopkg.in/yaml.v3"
+)
+
+// Signs offline the batch downloaded from the admin /signing endpoint of a view-only gateway. The
+// result is uploaded back to the same endpoint
+var app struct {
+	config string
+	in     string
+	out    string
+}
+
+func init() {
+	flagset := flag.NewFlagSet("signer", flag.ExitOnError)
+	flagset.StringVar(&app.config, "config", "signer.yaml", "YAML configuration")
+	flagset.StringVar(&app.in, "in", "signing.json", "JSON batch returned by GET /signing")
+	flagset.StringVar(&app.out, "out", "signed.json", "JSON batch to POST to /signing")
+	err := flagset.Parse(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Fails when the transaction set doesn't pay exactly the destinations prepared by the gateway.
+// Every recipient is printed for the operator. unlisted holds the recipients outside the allowed
+// addresses, like the payers receiving refunds
+func verify(ctx context.Context, client *rpc.Client, allowed []string, unsigned *gateway.UnsignedTransfer) (unlisted []rpc.Destination, err error) {
+	res, err := client.DescribeTransfer(ctx, &rpc.DescribeTransferRequest{UnsignedTxset: unsigned.Transfer.Txset})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe transfer: %w", err)
+	}
+	if len(res.Desc) != 1 {
+		return nil, fmt.Errorf("expecting a single transaction but got %d", len(res.Desc))
+	}
+
+	desc := res.Desc[0]
+	log.Printf("[*] Payment %v leg %s, fee %d", unsigned.Payment, unsigned.Leg, desc.Fee)
+	expected := slices.Clone(unsigned.Transfer.Destinations)
+	for _, recipient := range desc.Recipients {
+		log.Printf("[*]     %d to %s", recipient.Amount, recipient.Address)
+		index := slices.Index(expected, wallets.Destination{Address: recipient.Address, Amount: recipient.Amount})
+		if index == -1 {
+			return nil, fmt.Errorf("unexpected recipient %s of %d", recipient.Address, recipient.Amount)
+		}
+		expected = slices.Delete(expected, index, index+1)
+
+		if !slices.Contains(allowed, recipient.Address) {
+			unlisted = append(unlisted, recipient)
+		}
+	}
+	if len(expected) > 0 {
+		return nil, fmt.Errorf("missing recipient %s of %d", expected[0].Address, expected[0].Amount)
+	}
+	return unlisted, nil
+}
+
+// Asks the operator a yes or no question. Anything but "y" is a no
+func confirm(stdin *bufio.Reader, question string) (confirmed bool, err error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	return strings.ToLower(strings.TrimSpace(answer)) == "y", nil
+}
+
+// Signs the transfers paying only allowed addresses and the ones paying other addresses the
+// operator confirmed one by one. Transfers that can't be verified or signed are reported and
+// left to the next batch
+func sign(ctx context.Context, client *rpc.Client, allowed []string, batch *gateway.SigningBatch) (signed gateway.SignedBatch, err error) {
+	imported, err := client.ImportOutputs(ctx, &rpc.ImportOutputsRequest{OutputsDataHex: batch.Outputs})
+	if err != nil {
+		return signed, fmt.Errorf("failed to import outputs: %w", err)
+	}
+	log.Println("[*] Imported outputs:", imported.NumImported)
+
+	stdin := bufio.NewReader(os.Stdin)
+	var accepted []gateway.UnsignedTransfer
+	for _, unsigned := range batch.Transfers {
+		unlisted, err := verify(ctx, client, allowed, &unsigned)
+		if err != nil {
+			log.Printf("[!] Skipping transfer of payment %v leg %s: %v", unsigned.Payment, unsigned.Leg, err)
+			continue
+		}
+
+		rejected := false
+		for _, recipient := range unlisted {
+			question := fmt.Sprintf("Payment %v leg %s pays %d to %s outside the allowed addresses. Allow?", unsigned.Payment, unsigned.Leg, recipient.Amount, recipient.Address)
+			confirmed, err := confirm(stdin, question)
+			if err != nil {
+				return signed, err
+			}
+			if !confirmed {
+				log.Printf("[!] Skipping transfer of payment %v leg %s: recipient %s not allowed", unsigned.Payment, unsigned.Leg, recipient.Address)
+				rejected = true
+				break
+			}
+		}
+		if !rejected {
+			accepted = append(accepted, unsigned)
+		}
+	}
+
+	confirmed, err := confirm(stdin, fmt.Sprintf("Sign %d of %d transfers?", len(accepted), len(batch.Transfers)))
+	if err != nil {
+		return signed, err
+	}
+	if !confirmed {
+		return signed, errors.New("signing not confirmed")
+	}
+
+	for _, unsigned := range accepted {
+		res, err := client.SignTransfer(ctx, &rpc.SignTransferRequest{UnsignedTxset: unsigned.Transfer.Txset})
+		if err != nil {
+			log.Printf("[!] Skipping transfer of payment %v leg %s: failed to sign: %v", unsigned.Payment, unsigned.Leg, err)
+			continue
+		}
+		log.Println("[*] Signed transfer:", unsigned.Payment, unsigned.Leg)
+
+		signed.Transfers = append(signed.Transfers, gateway.SignedTransfer{
+			Payment: unsigned.Payment,
+			Leg:     unsigned.Leg,
+			Txset:   res.SignedTxset,
+		})
+	}
+
+	// Every key image so the gateway also learns the outputs spent by the new transfers
+	keyImages, err := client.ExportKeyImages(ctx, &rpc.ExportKeyImagesRequest{All: true})
+	if err != nil {
+		return signed, fmt.Errorf("failed to export key images: %w", err)
+	}
+	for _, keyImage := range keyImages.SignedKeyImages {
+		signed.KeyImages = append(signed.KeyImages, wallets.KeyImage{
+			KeyImage:  keyImage.KeyImage,
+			Signature: keyImage.Signature,
+		})
+	}
+	return signed, nil
+}
+
+func main() {
+	configContents, err := os.ReadFile(app.config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cfg Config
+	err = yaml.Unmarshal(configContents, &cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cfg.AllowedAddresses) == 0 {
+		log.Fatal("allowed-addresses is required")
+	}
+
+	batchContents, err := os.ReadFile(app.in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var batch gateway.SigningBatch
+	err = json.Unmarshal(batchContents, &batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client := cfg.Wallet.Compile()
+	err = client.OpenWallet(ctx, &rpc.OpenWalletRequest{
+		Filename: cfg.Wallet.Filename,
+		Password: cfg.Wallet.Password,
+	})
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to open wallet: %w", err))
+	}
+
+	signed, err := sign(ctx, client, cfg.AllowedAddresses, &batch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signedContents, err := json.MarshalIndent(&signed, "", "\t")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile(app.out, signedContents, 0o600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("[*] Signed transfers: %d of %d", len(signed.Transfers), len(batch.Transfers))
+}
@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotCancelable  = errors.New("payment can't be canceled")
+	ErrNothingToRetry = errors.New("payment has no errored leg")
+)
+
+// Reports if the leg stopped because of a wallet error
+func errored(status Status) (ok bool) {
+	return status == StatusError || status == StatusFailed
+}
+
+// Retry queues again the first errored or failed leg of the payment resetting its attempts.
+// It is processed on the next run
+func (c *Controller) Retry(ctx context.Context, id uuid.UUID) (payment Payment, err error) {
+	c.pending.Lock()
+	defer c.pending.Unlock()
+
+	payment, err = c.Query(ctx, id)
+	if err != nil {
+		return payment, err
+	}
+
+	var key []byte
+	switch {
+	case errored(payment.Beneficiary.Status):
+		payment.Beneficiary.Status = StatusPending
+		payment.Beneficiary.Error = ""
+		payment.Beneficiary.Retry = Retry{}
+		key = PendingKey(id)
+	case errored(payment.Fee.Status):
+		payment.Fee.Status = StatusPending
+		payment.Fee.Error = ""
+		payment.Fee.Retry = Retry{}
+		key = FeeKey(id)
+	case errored(payment.Refund.Status):
+		payment.Refund.Status = StatusPending
+		payment.Refund.Error = ""
+		payment.Refund.Retry = Retry{}
+		key = RefundKey(id)
+	default:
+		return payment, ErrNothingToRetry
+	}
+
+	err = c.savePaymentState(payment)
+	if err != nil {
+		return payment, fmt.Errorf("failed to save payment: %w", err)
+	}
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		return txn.Set(key, id[:])
+	})
+	if err != nil {
+		return payment, fmt.Errorf("failed to queue payment: %w", err)
+	}
+	return payment, nil
+}
+
+// Cancel stops waiting for a pending payment that didn't receive any funds.
+// Deposits received later are handled by the late deposit policy
+func (c *Controller) Cancel(ctx context.Context, id uuid.UUID) (payment Payment, err error) {
+	err = c.sync(ctx)
+	if err != nil {
+		return payment, err
+	}
+
+	c.pending.Lock()
+	defer c.pending.Unlock()
+
+	payment, err = c.Query(ctx, id)
+	if err != nil {
+		return payment, err
+	}
+	if payment.Beneficiary.Status != StatusPending {
+		return payment, fmt.Errorf("%w: status is %s", ErrNotCancelable, payment.Beneficiary.Status)
+	}
+
+	address, err := c.getReceiverAddress(ctx, payment.Receiver, nil)
+	if err != nil {
+		return payment, fmt.Errorf("failed to get address: %w", err)
+	}
+	if address.Balance > 0 || len(payment.Seen.Transactions) > 0 {
+		return payment, fmt.Errorf("%w: funds already received", ErrNotCancelable)
+	}
+
+	payment.Beneficiary.Status = StatusCanceled
+	payment.Fee.Status = StatusCanceled
+
+	err = c.savePaymentState(payment)
+	if err != nil {
+		return payment, fmt.Errorf("failed to save payment: %w", err)
+	}
+	err = c.deleteKey(PendingKey(id))
+	if err != nil {
+		return payment, fmt.Errorf("failed to delete pending payment entry: %w", err)
+	}
+
+	err = c.finalize(payment)
+	if err != nil {
+		return payment, fmt.Errorf("failed to finalize payment: %w", err)
+	}
+
+	err = c.recycle(payment, "")
+	if err != nil {
+		return payment, fmt.Errorf("failed to recycle receiver: %w", err)
+	}
+	return payment, nil
+}
+
+// Balance of a receiver and its current owner
+type ReceiverBalance struct {
+	// Last payment that used the receiver. Nil for receivers released unused
+	Payment uuid.UUID
+	// Wallet state of the receiver
+	Address wallets.Address
+}
+
+// Balances returns the wallet balance of every receiver used by the gateway
+func (c *Controller) Balances(ctx context.Context) (balances []ReceiverBalance, err error) {
+	var owners []uuid.UUID
+	var indexes []uint64
+	prefix := []byte(receiverPrefix)
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = prefix
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+
+			index, err := strconv.ParseUint(string(item.Key()[len(prefix):]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse receiver index: %w", err)
+			}
+
+			var owner uuid.UUID
+			err = item.Value(func(val []byte) (err error) {
+				owner, err = uuid.FromBytes(val)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to parse receiver owner: %w", err)
+			}
+			owners = append(owners, owner)
+			indexes = append(indexes, index)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list receivers: %w", err)
+	}
+
+	err = c.sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := wallets.Addresses(ctx, c.wallet, wallets.AddressesRequest{Indices: indexes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve addresses: %w", err)
+	}
+
+	balances = make([]ReceiverBalance, 0, len(addresses))
+	for i, address := range addresses {
+		balances = append(balances, ReceiverBalance{Payment: owners[i], Address: address})
+	}
+	return balances, nil
+}
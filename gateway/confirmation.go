@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Confirmations required to consider confirmed the payments up to MaxAmount
+type ConfirmationTier struct {
+	// Maximum amount of the payments covered by the tier
+	MaxAmount uint64
+	// Confirmations required by every received transfer
+	Confirmations uint64
+}
+
+// Sorts the tiers by amount so the first matching tier is the strictest applicable
+func sortTiers(tiers []ConfirmationTier) (sorted []ConfirmationTier) {
+	sorted = slices.Clone(tiers)
+	slices.SortFunc(sorted, func(a, b ConfirmationTier) int { return cmp.Compare(a.MaxAmount, b.MaxAmount) })
+	return sorted
+}
+
+// Returns the confirmations required for the amount. Amounts above every tier are only
+// considered once unlocked
+func (c *Controller) requiredConfirmations(amount uint64) (confirmations uint64, found bool) {
+	for _, tier := range c.confirmations {
+		if amount <= tier.MaxAmount {
+			return tier.Confirmations, true
+		}
+	}
+	return 0, false
+}
+
+// Reports if the locked funds of the receiver already have the confirmations required by the payment.
+// Transfers below the required confirmations are discounted from the balance so outputs of previous
+// owners of a recycled receiver, already spent, never count
+func (c *Controller) confirmed(p *Payment, address *wallets.Address, transfers []wallets.IncomingTransfer) (ok bool) {
+	required, found := c.requiredConfirmations(p.Amount)
+	if !found {
+		return false
+	}
+
+	var unconfirmed uint64
+	for _, transfer := range transfers {
+		if transfer.InPool || transfer.Confirmations >= required {
+			continue
+		}
+		unconfirmed += transfer.Amount
+	}
+
+	if unconfirmed >= address.Balance {
+		return false
+	}
+	return address.Balance-unconfirmed >= p.Amount
+}
@@ -2,8 +2,14 @@ package gateway
 
 import (
 	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/metrics"
+	"github.com/RogueTeam/8ball/oracles"
 	"github.com/RogueTeam/8ball/wallets"
 	badger "github.com/dgraph-io/badger/v4"
 )
@@ -20,6 +26,24 @@ type Controller struct {
 	feePercentage uint64
 	address       string
 	wallet        wallets.Wallet
+	webhook       WebhookConfig
+	webhookClient *http.Client
+
+	recycleQuarantine time.Duration
+	lateDepositPolicy LateDepositPolicy
+	confirmations     []ConfirmationTier
+	refund            RefundPolicy
+	singleTransaction bool
+	viewOnly          bool
+	oracle            oracles.Oracle
+	broker            *broker
+	syncer            *syncer
+	// Serializes the payments loop with the payments processed by the wallet events
+	pending           *sync.Mutex
+	retry             RetryConfig
+	idempotencyWindow time.Duration
+	metrics           *metrics.Metrics
+	logger            *slog.Logger
 }
 
 type Config struct {
@@ -39,6 +63,33 @@ type Config struct {
 	Address string
 	// Wallets to be used for managing transactions
 	Wallet wallets.Wallet
+	// Delivery settings of the payment status notifications
+	Webhook WebhookConfig
+	// Time an expired or swept receiver waits before being reused by other payment.
+	// Receivers are never reused when zero
+	RecycleQuarantine time.Duration
+	// Action taken over funds received after a payment was finalized. Defaults to review
+	LateDepositPolicy LateDepositPolicy
+	// Confirmations required to report payments as confirmed before their funds unlock.
+	// Payments above every tier are only confirmed once unlocked
+	Confirmations []ConfirmationTier
+	// Payments refunded to the payer instead of forwarded. Requires a refund address on the payment
+	Refund RefundPolicy
+	// Pays beneficiary and fee in a single transaction when the wallet supports it
+	SingleTransaction bool
+	// Exchange rates of the payments priced in other currencies
+	Oracle oracles.Oracle
+	// Retries of the beneficiary, fee and refund legs after wallet errors
+	Retry RetryConfig
+	// Time idempotency keys are remembered. Defaults to DefaultIdempotencyWindow
+	IdempotencyWindow time.Duration
+	// Prometheus collectors. Disabled when nil
+	Metrics *metrics.Metrics
+	// Structured logger. Defaults to text records on stderr with addresses and transactions redacted
+	Logger *slog.Logger
+	// Prepares the transfers unsigned with a wallets.ViewOnly wallet. Legs wait in the
+	// awaiting-signature status until their transfer is signed offline and submitted
+	ViewOnly bool
 }
 
 func New(config Config) (ctrl Controller) {
@@ -49,6 +100,39 @@ func New(config Config) (ctrl Controller) {
 	ctrl.feePercentage = config.FeePercentage
 	ctrl.address = config.Address
 	ctrl.wallet = config.Wallet
+	ctrl.webhook = config.Webhook
+	ctrl.webhook.setDefaults()
+	ctrl.webhookClient = ctrl.webhook.client()
+	ctrl.recycleQuarantine = config.RecycleQuarantine
+	ctrl.lateDepositPolicy = config.LateDepositPolicy
+	ctrl.confirmations = sortTiers(config.Confirmations)
+	ctrl.refund = config.Refund
+	ctrl.singleTransaction = config.SingleTransaction
+	ctrl.viewOnly = config.ViewOnly
+	ctrl.oracle = config.Oracle
+	ctrl.broker = newBroker()
+	ctrl.syncer = new(syncer)
+	ctrl.pending = new(sync.Mutex)
+	ctrl.retry = config.Retry
+	ctrl.retry.setDefaults()
+	ctrl.metrics = config.Metrics
+	ctrl.logger = config.Logger
+	if ctrl.logger == nil {
+		ctrl.logger = logging.New(logging.Config{})
+	}
+	ctrl.idempotencyWindow = config.IdempotencyWindow
+	if ctrl.idempotencyWindow == 0 {
+		ctrl.idempotencyWindow = DefaultIdempotencyWindow
+	}
 
 	return ctrl
 }
+
+// Logger scoped to a leg of the payment
+func (c *Controller) paymentLogger(p *Payment, leg string) (logger *slog.Logger) {
+	return c.logger.With(
+		logging.KeyPayment, p.Id,
+		logging.KeyReceiver, p.Receiver.Index,
+		logging.KeyLeg, leg,
+	)
+}
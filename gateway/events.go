@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// In-process pub/sub of the payment states saved by the controller
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan Payment]struct{}
+}
+
+func newBroker() (b *broker) {
+	return &broker{subscribers: map[uuid.UUID]map[chan Payment]struct{}{}}
+}
+
+// Delivers the state to every subscriber of the payment without blocking.
+// Slow subscribers only keep the latest state
+func (b *broker) publish(p Payment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for events := range b.subscribers[p.Id] {
+		select {
+		case <-events:
+		default:
+		}
+		events <- p
+	}
+}
+
+// Subscribe returns a channel receiving every new state of the payment.
+// The channel is closed when cancel is called
+func (c *Controller) Subscribe(id uuid.UUID) (events <-chan Payment, cancel func()) {
+	b := c.broker
+
+	ch := make(chan Payment, 1)
+
+	b.mu.Lock()
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = map[chan Payment]struct{}{}
+	}
+	b.subscribers[id][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subscribers[id], ch)
+			if len(b.subscribers[id]) == 0 {
+				delete(b.subscribers, id)
+			}
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
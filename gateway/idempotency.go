@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// Maximum length of the client supplied idempotency keys
+const MaxIdempotencyKeyLength = 255
+
+var ErrIdempotencyMismatch = errors.New("idempotency key already used with a different request")
+
+const idempotencyPrefix = "/idempotency/"
+
+// Idempotency keys are scoped to the merchant creating the payment
+func IdempotencyKey(merchant uuid.UUID, key string) (dbKey []byte) {
+	return []byte(idempotencyPrefix + merchant.String() + "/" + key)
+}
+
+// Payment created with an idempotency key
+type Idempotent struct {
+	// Payment created by the first request
+	Payment uuid.UUID
+	// Hash of the first request
+	Hash string
+}
+
+func (i *Idempotent) Bytes() (bytes []byte) {
+	bytes, _ = json.Marshal(i)
+	return bytes
+}
+
+func (i *Idempotent) FromBytes(b []byte) (err error) {
+	return json.Unmarshal(b, i)
+}
+
+// Hashes the fields of the request supplied by the client
+func (r *Receive) hash() (hash string) {
+	var price string
+	if r.Price.Value != nil {
+		price = r.Price.Value.Text('g', -1)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%q|%d|%q|%q|%q|%q|%q|%s|%q",
+		r.Address, r.Amount, r.Priority, r.Currency, price, r.CallbackUrl, r.RefundAddress, r.Merchant, r.OrderId)
+	for _, key := range slices.Sorted(maps.Keys(r.Metadata)) {
+		fmt.Fprintf(h, "|%q=%q", key, r.Metadata[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the payment previously created with the same idempotency key
+func (c *Controller) replay(txn *badger.Txn, req *Receive, hash string) (payment Payment, found bool, err error) {
+	item, err := txn.Get(IdempotencyKey(req.Merchant, req.IdempotencyKey))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return payment, false, nil
+		}
+		return payment, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	var idempotent Idempotent
+	err = item.Value(idempotent.FromBytes)
+	if err != nil {
+		return payment, false, fmt.Errorf("failed to unmarshal idempotency key: %w", err)
+	}
+	if idempotent.Hash != hash {
+		return payment, false, ErrIdempotencyMismatch
+	}
+
+	item, err = txn.Get(PaymentKey(idempotent.Payment))
+	if err != nil {
+		return payment, false, fmt.Errorf("failed to get payment: %w", err)
+	}
+	err = item.Value(payment.FromBytes)
+	if err != nil {
+		return payment, false, fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment, true, nil
+}
+
+// Remembers the payment created with the idempotency key during the configured window
+func (c *Controller) remember(txn *badger.Txn, req *Receive, hash string, payment *Payment) (err error) {
+	idempotent := Idempotent{Payment: payment.Id, Hash: hash}
+	entry := badger.NewEntry(IdempotencyKey(req.Merchant, req.IdempotencyKey), idempotent.Bytes()).
+		WithTTL(c.idempotencyWindow)
+	err = txn.SetEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to set idempotency key: %w", err)
+	}
+	return nil
+}
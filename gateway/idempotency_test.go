@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/oracles"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// Oracle answering a single request
+type onceOracle struct {
+	rate  oracles.Rate
+	calls int
+}
+
+func (o *onceOracle) Rate(ctx context.Context, req oracles.RateRequest) (rate oracles.Rate, err error) {
+	o.calls++
+	if o.calls > 1 {
+		return rate, errors.New("oracle down")
+	}
+	return o.rate, nil
+}
+
+func Test_Replay(t *testing.T) {
+	t.Parallel()
+	assertions := assert.New(t)
+
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if !assertions.Nil(err, "failed to open database") {
+		return
+	}
+	defer db.Close()
+
+	var rate, price decimal.Decimal
+	assertions.Nil(rate.FromString("150"), "failed to parse rate")
+	assertions.Nil(price.FromString("15"), "failed to parse price")
+
+	oracle := &onceOracle{rate: oracles.Rate{Currency: "USD", Price: rate}}
+	wallet := mock.New(mock.Config{})
+	c := New(Config{
+		DB:        db,
+		Wallet:    wallet,
+		MaxAmount: ^uint64(0),
+		Oracle:    oracle,
+	})
+
+	receive := Receive{
+		Address:        "mock_beneficiary",
+		Currency:       "USD",
+		Price:          price,
+		Priority:       wallets.PriorityHigh,
+		IdempotencyKey: "order-1",
+	}
+	first, err := c.Receive(ctx, &receive)
+	if !assertions.Nil(err, "failed to create payment") {
+		return
+	}
+
+	repeated, err := c.Receive(ctx, &receive)
+	assertions.Nil(err, "replays shouldn't need the oracle")
+	assertions.Equal(first.Id, repeated.Id, "replays should return the original payment")
+	assertions.Equal(1, oracle.calls, "replays shouldn't quote the price again")
+
+	_, err = wallet.Address(ctx, wallets.AddressRequest{Index: first.Receiver.Index + 1})
+	assertions.ErrorIs(err, mock.ErrAddressNotFound, "replays shouldn't create receivers")
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/RogueTeam/8ball/logging"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+// Secondary indexes of the payments. Every entry ends with the position of the payment
+// "<created unix nano>/<id>" so all of them are sorted by creation time
+const (
+	indexPrefix            = "/index/"
+	createdIndexPrefix     = indexPrefix + "created/"
+	statusIndexPrefix      = indexPrefix + "status/"
+	beneficiaryIndexPrefix = indexPrefix + "beneficiary/"
+	merchantIndexPrefix    = indexPrefix + "merchant/"
+	// Version of the indexes present in the database
+	indexVersionKey = indexPrefix + "version"
+)
+
+// Increased every time the indexes change so Reindex rebuilds them
+const indexVersion = "1"
+
+// Legs of the payment with their own status index
+const (
+	LegBeneficiary = "beneficiary"
+	LegFee         = "fee"
+	LegRefund      = "refund"
+)
+
+// Position of the payment inside every index
+func position(p *Payment) (pos string) {
+	var created int64
+	if !p.Created.IsZero() {
+		created = max(p.Created.UnixNano(), 0)
+	}
+	return fmt.Sprintf("%020d/%s", created, p.Id)
+}
+
+func CreatedIndexPrefix() (prefix []byte) {
+	return []byte(createdIndexPrefix)
+}
+
+func StatusIndexPrefix(leg string, status Status) (prefix []byte) {
+	return []byte(statusIndexPrefix + leg + "/" + string(status) + "/")
+}
+
+func BeneficiaryIndexPrefix(address string) (prefix []byte) {
+	return []byte(beneficiaryIndexPrefix + address + "/")
+}
+
+func MerchantIndexPrefix(merchant uuid.UUID) (prefix []byte) {
+	return []byte(merchantIndexPrefix + merchant.String() + "/")
+}
+
+// Every index entry of the payment
+func indexKeys(p *Payment) (keys [][]byte) {
+	pos := position(p)
+	keys = [][]byte{
+		append(CreatedIndexPrefix(), pos...),
+		append(StatusIndexPrefix(LegBeneficiary, p.Beneficiary.Status), pos...),
+		append(StatusIndexPrefix(LegFee, p.Fee.Status), pos...),
+		append(BeneficiaryIndexPrefix(p.Beneficiary.Address), pos...),
+		append(MerchantIndexPrefix(p.Merchant), pos...),
+	}
+	if p.Refund.Status != "" {
+		keys = append(keys, append(StatusIndexPrefix(LegRefund, p.Refund.Status), pos...))
+	}
+	return keys
+}
+
+// Replaces the index entries of the previous state with the ones of the current. Previous is nil for new payments
+func updateIndexes(txn *badger.Txn, previous, current *Payment) (err error) {
+	keep := map[string]struct{}{}
+	for _, key := range indexKeys(current) {
+		keep[string(key)] = struct{}{}
+		err = txn.Set(key, current.Id[:])
+		if err != nil {
+			return fmt.Errorf("failed to set index: %w", err)
+		}
+	}
+	if previous == nil {
+		return nil
+	}
+	for _, key := range indexKeys(previous) {
+		if _, found := keep[string(key)]; found {
+			continue
+		}
+		err = txn.Delete(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete index: %w", err)
+		}
+	}
+	return nil
+}
+
+// Opaque representation of the position of a payment
+func encodeCursor(p *Payment) (cursor string) {
+	return base64.RawURLEncoding.EncodeToString([]byte(position(p)))
+}
+
+func decodeCursor(cursor string) (pos string, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor: %w", err)
+	}
+	return string(raw), nil
+}
+
+// Reindex builds the indexes of payments created before they existed. It does nothing when
+// the indexes are up to date
+func (c *Controller) Reindex() (indexed uint64, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		item, err := txn.Get([]byte(indexVersionKey))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) (err error) {
+			if string(val) != indexVersion {
+				return badger.ErrKeyNotFound
+			}
+			return nil
+		})
+	})
+	switch {
+	case err == nil:
+		return 0, nil
+	case !errors.Is(err, badger.ErrKeyNotFound):
+		return 0, fmt.Errorf("failed to get index version: %w", err)
+	}
+
+	var ids []uuid.UUID
+	prefix := []byte(paymentsPrefix)
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = prefix
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			id, err := uuid.ParseBytes(it.Item().Key()[len(prefix):])
+			if err != nil {
+				c.logger.Warn("invalid payment key", "key", string(it.Item().Key()), logging.KeyError, err)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list payments: %w", err)
+	}
+
+	for _, id := range ids {
+		err = c.db.Update(func(txn *badger.Txn) (err error) {
+			item, err := txn.Get(PaymentKey(id))
+			if err != nil {
+				return fmt.Errorf("failed to get payment: %w", err)
+			}
+			var payment Payment
+			err = item.Value(payment.FromBytes)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal payment: %w", err)
+			}
+			return updateIndexes(txn, nil, &payment)
+		})
+		if err != nil {
+			return indexed, fmt.Errorf("failed to index payment %v: %w", id, err)
+		}
+		indexed++
+	}
+
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		return txn.Set([]byte(indexVersionKey), []byte(indexVersion))
+	})
+	if err != nil {
+		return indexed, fmt.Errorf("failed to set index version: %w", err)
+	}
+	return indexed, nil
+}
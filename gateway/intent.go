@@ -0,0 +1,388 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+const intentPrefix = "/intent/"
+
+var intentPrefixBytes = []byte(intentPrefix)
+
+// Intents are scoped to the leg of the payment making the transfer
+func IntentKey(id uuid.UUID, leg string) (key []byte) {
+	return []byte(intentPrefix + id.String() + "/" + leg)
+}
+
+// Outgoing wallet call journaled before it is made. A transfer found for an intent is
+// replayed instead of made again so every leg pays out exactly once
+type Intent struct {
+	// Payment moving the funds
+	Payment uuid.UUID
+	// Leg of the payment moving the funds
+	Leg string
+	// State of the receiver that decided the transfer. Replays process the leg with it
+	Receiver wallets.Address
+	// Addresses receiving the funds, in the order of the request
+	Destinations []string
+	// Amounts requested for each destination. Sweeps request the unlocked balance of the receiver.
+	// The network fee may be discounted from them
+	Amounts []uint64
+	// Moment the intent was written
+	Created time.Time
+	// Transfer made by the wallet. Nil until the wallet reports it
+	Transfer *wallets.TransferMany
+	// Transfer prepared by a view-only wallet. Nil unless the gateway is view-only
+	Unsigned *wallets.UnsignedTransfer
+}
+
+func (i *Intent) Bytes() (bytes []byte) {
+	bytes, _ = json.Marshal(i)
+	return bytes
+}
+
+func (i *Intent) FromBytes(b []byte) (err error) {
+	return json.Unmarshal(b, i)
+}
+
+// Transactions already recorded by the payment
+func (p *Payment) transactions() (transactions []string) {
+	for _, tx := range []string{p.Beneficiary.Transaction, p.Fee.Transaction, p.Refund.Transaction} {
+		if tx != "" {
+			transactions = append(transactions, tx)
+		}
+	}
+	for _, deposit := range p.LateDeposits {
+		if deposit.Transaction != "" {
+			transactions = append(transactions, deposit.Transaction)
+		}
+	}
+	return transactions
+}
+
+func (c *Controller) intent(id uuid.UUID, leg string) (intent Intent, found bool, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		item, err := txn.Get(IntentKey(id, leg))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return fmt.Errorf("failed to get intent: %w", err)
+		}
+		found = true
+		return item.Value(intent.FromBytes)
+	})
+	return intent, found, err
+}
+
+func (c *Controller) saveIntent(intent *Intent) (err error) {
+	return c.db.Update(func(txn *badger.Txn) (err error) {
+		return txn.Set(IntentKey(intent.Payment, intent.Leg), intent.Bytes())
+	})
+}
+
+// Removes the intents whose transfer is already recorded by the payment
+func deleteIntents(txn *badger.Txn, p *Payment) (err error) {
+	prefix := []byte(intentPrefix + p.Id.String() + "/")
+
+	options := badger.DefaultIteratorOptions
+	options.Prefix = prefix
+	it := txn.NewIterator(options)
+	defer it.Close()
+
+	var keys [][]byte
+	for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+		var intent Intent
+		err = it.Item().Value(intent.FromBytes)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal intent: %w", err)
+		}
+		if intent.Transfer != nil && slices.Contains(p.transactions(), intent.Transfer.Address) {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+	}
+
+	for _, key := range keys {
+		err = txn.Delete(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete intent: %w", err)
+		}
+	}
+	return nil
+}
+
+// Index of the destination of the outgoing transfer paying the amount requested by the intent.
+// The network fee may be discounted from the requested amount. -1 when none pays it
+func (i *Intent) pays(o *wallets.OutgoingTransfer, destination int) (index int) {
+	return slices.IndexFunc(o.Destinations, func(d wallets.Destination) bool {
+		if d.Address != i.Destinations[destination] {
+			return false
+		}
+		// Intents journaled before the amounts were recorded
+		if len(i.Amounts) != len(i.Destinations) {
+			return true
+		}
+		requested := i.Amounts[destination]
+		return d.Amount <= requested && d.Amount+o.Fee >= requested
+	})
+}
+
+// Looks for the transfer of an intent without one in the wallet history. Intents the
+// wallet never made are deleted unless they are awaiting a signature. Only transfers made
+// from the receiver after the intent was written, paying its amounts and unknown to every
+// owner of the receiver are adopted
+func (c *Controller) resolve(ctx context.Context, p *Payment, intent *Intent) (err error) {
+	if intent.Transfer != nil {
+		return nil
+	}
+
+	outgoing, err := c.wallet.OutgoingTransfers(ctx, wallets.OutgoingTransfersRequest{Index: intent.Receiver.Index})
+	if err != nil {
+		return fmt.Errorf("failed to list outgoing transfers: %w", err)
+	}
+
+	history, err := c.receiverHistory(intent.Receiver.Index)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve receiver history: %w", err)
+	}
+	known := append(p.transactions(), history...)
+
+	// Wallets report the timestamps in seconds
+	since := intent.Created.Truncate(time.Second)
+	for _, o := range outgoing {
+		if o.SourceIndex != intent.Receiver.Index || o.Timestamp.Before(since) || slices.Contains(known, o.TransactionId) {
+			continue
+		}
+
+		transfer := wallets.TransferMany{
+			Address:     o.TransactionId,
+			SourceIndex: intent.Receiver.Index,
+			Fee:         o.Fee,
+		}
+		for destination := range intent.Destinations {
+			index := intent.pays(&o, destination)
+			if index == -1 {
+				break
+			}
+			transfer.Destinations = append(transfer.Destinations, o.Destinations[index])
+		}
+		if len(transfer.Destinations) != len(intent.Destinations) {
+			continue
+		}
+
+		c.paymentLogger(p, intent.Leg).Warn("transfer recovered from the wallet history", logging.KeyTransaction, o.TransactionId)
+		intent.Transfer = &transfer
+		return c.saveIntent(intent)
+	}
+
+	if intent.Unsigned != nil {
+		return nil
+	}
+	return c.deleteKey(IntentKey(intent.Payment, intent.Leg))
+}
+
+// Receiver state used to process a leg of the payment. Legs with a transfer already made
+// reuse the state that decided it so the transfer is replayed
+func (c *Controller) receiverState(ctx context.Context, p *Payment, leg string, balances balances) (address wallets.Address, err error) {
+	intent, found, err := c.intent(p.Id, leg)
+	if err != nil {
+		return address, fmt.Errorf("failed to retrieve intent: %w", err)
+	}
+	if found {
+		err = c.resolve(ctx, p, &intent)
+		if err != nil {
+			return address, fmt.Errorf("failed to resolve intent: %w", err)
+		}
+		if intent.Transfer != nil || intent.Unsigned != nil {
+			return intent.Receiver, nil
+		}
+	}
+	return c.getReceiverAddress(ctx, p.Receiver, balances)
+}
+
+// Makes the outgoing wallet call of a leg at most once. The intent is journaled before the call
+// and deleted by savePaymentState once the payment records the transaction. Failed calls keep
+// the intent until the wallet history proves the transfer was never made. View-only gateways
+// prepare the transfer instead and fail with ErrAwaitingSignature until it is submitted
+func (c *Controller) journal(ctx context.Context, p *Payment, leg string, receiver wallets.Address, destinations []wallets.Destination, call func() (transfer wallets.TransferMany, err error), prepare func(signer wallets.ViewOnly) (unsigned wallets.UnsignedTransfer, err error)) (transfer wallets.TransferMany, err error) {
+	intent, found, err := c.intent(p.Id, leg)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to retrieve intent: %w", err)
+	}
+	if found {
+		err = c.resolve(ctx, p, &intent)
+		if err != nil {
+			return transfer, fmt.Errorf("failed to resolve intent: %w", err)
+		}
+		if intent.Transfer != nil {
+			return *intent.Transfer, nil
+		}
+		if intent.Unsigned != nil {
+			return transfer, ErrAwaitingSignature
+		}
+	}
+
+	intent = Intent{
+		Payment:  p.Id,
+		Leg:      leg,
+		Receiver: receiver,
+		Created:  time.Now(),
+	}
+	for _, destination := range destinations {
+		intent.Destinations = append(intent.Destinations, destination.Address)
+		intent.Amounts = append(intent.Amounts, destination.Amount)
+	}
+	err = c.saveIntent(&intent)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to save intent: %w", err)
+	}
+
+	if c.viewOnly {
+		return transfer, c.prepare(p, &intent, prepare)
+	}
+
+	transfer, err = call()
+	if err != nil {
+		return transfer, err
+	}
+
+	intent.Transfer = &transfer
+	err = c.saveIntent(&intent)
+	if err != nil {
+		// The next attempt finds the transfer in the wallet history
+		return transfer, fmt.Errorf("failed to save intent transfer: %w", err)
+	}
+	return transfer, nil
+}
+
+// Journaled version of wallets.Wallet.Transfer
+func (c *Controller) transfer(ctx context.Context, p *Payment, leg string, receiver wallets.Address, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	destinations := []wallets.Destination{{Address: req.Destination, Amount: req.Amount}}
+	result, err := c.journal(ctx, p, leg, receiver, destinations, func() (result wallets.TransferMany, err error) {
+		transfer, err := c.wallet.Transfer(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		result = wallets.TransferMany{
+			Address:      transfer.Address,
+			SourceIndex:  transfer.SourceIndex,
+			Destinations: []wallets.Destination{{Address: transfer.Destination, Amount: transfer.Amount}},
+			Fee:          transfer.Fee,
+		}
+		return result, nil
+	}, func(signer wallets.ViewOnly) (unsigned wallets.UnsignedTransfer, err error) {
+		return signer.PrepareTransfer(ctx, req)
+	})
+	if err != nil {
+		return transfer, err
+	}
+
+	transfer = wallets.Transfer{
+		Address:     result.Address,
+		SourceIndex: result.SourceIndex,
+		Destination: result.Destinations[0].Address,
+		Amount:      result.Destinations[0].Amount,
+		Fee:         result.Fee,
+	}
+	return transfer, nil
+}
+
+// Journaled version of wallets.Wallet.SweepAll
+func (c *Controller) sweep(ctx context.Context, p *Payment, leg string, receiver wallets.Address, req wallets.SweepRequest) (sweep wallets.Sweep, err error) {
+	// Sweeps spend the unlocked balance of the receiver
+	destinations := []wallets.Destination{{Address: req.Destination, Amount: receiver.UnlockedBalance}}
+	result, err := c.journal(ctx, p, leg, receiver, destinations, func() (result wallets.TransferMany, err error) {
+		sweep, err := c.wallet.SweepAll(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		result = wallets.TransferMany{
+			Address:      sweep.Address,
+			SourceIndex:  sweep.SourceIndex,
+			Destinations: []wallets.Destination{{Address: sweep.Destination, Amount: sweep.Amount}},
+			Fee:          sweep.Fee,
+		}
+		return result, nil
+	}, func(signer wallets.ViewOnly) (unsigned wallets.UnsignedTransfer, err error) {
+		return signer.PrepareSweep(ctx, req)
+	})
+	if err != nil {
+		return sweep, err
+	}
+
+	sweep = wallets.Sweep{
+		Address:     result.Address,
+		SourceIndex: result.SourceIndex,
+		Destination: result.Destinations[0].Address,
+		Amount:      result.Destinations[0].Amount,
+		Fee:         result.Fee,
+	}
+	return sweep, nil
+}
+
+// Journaled version of wallets.MultiTransferer.TransferMany
+func (c *Controller) transferMany(ctx context.Context, p *Payment, leg string, receiver wallets.Address, multi wallets.MultiTransferer, req wallets.TransferManyRequest) (transfer wallets.TransferMany, err error) {
+	return c.journal(ctx, p, leg, receiver, req.Destinations, func() (transfer wallets.TransferMany, err error) {
+		return multi.TransferMany(ctx, req)
+	}, func(signer wallets.ViewOnly) (unsigned wallets.UnsignedTransfer, err error) {
+		return signer.PrepareTransferMany(ctx, req)
+	})
+}
+
+// Recover reconciles the intents left by an interrupted process with the wallet history.
+// Should run before processing the payments. recovered counts the transfers found
+func (c *Controller) Recover(ctx context.Context) (recovered uint64, err error) {
+	var intents []Intent
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = intentPrefixBytes
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(intentPrefixBytes); it.Next() {
+			var intent Intent
+			err = it.Item().Value(intent.FromBytes)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal intent: %w", err)
+			}
+			intents = append(intents, intent)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve intents: %w", err)
+	}
+
+	for _, intent := range intents {
+		if intent.Transfer != nil {
+			continue
+		}
+
+		var payment Payment
+		err = c.db.View(func(txn *badger.Txn) (err error) {
+			payment, err = getPayment(txn, intent.Payment)
+			return err
+		})
+		if err != nil {
+			return recovered, fmt.Errorf("failed to retrieve payment %v: %w", intent.Payment, err)
+		}
+
+		err = c.resolve(ctx, &payment, &intent)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to resolve intent of payment %v: %w", intent.Payment, err)
+		}
+		if intent.Transfer != nil {
+			recovered++
+		}
+	}
+	return recovered, nil
+}
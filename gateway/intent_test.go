@@ -0,0 +1,146 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resolve(t *testing.T) {
+	t.Parallel()
+
+	const (
+		destination = "mock_beneficiary"
+		amount      = 1_000_000
+	)
+
+	// Controller over a mock wallet whose funded address 0 plays the receiver
+	setup := func(t *testing.T) (c Controller, wallet *mock.Mock, p Payment) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		wallet = mock.New(mock.Config{})
+		c = New(Config{DB: db, Wallet: wallet, MaxAmount: ^uint64(0)})
+
+		p = Payment{
+			Id:       uuid.New(),
+			Receiver: Receiver{Address: "mock_address_0", Index: 0},
+		}
+		return c, wallet, p
+	}
+	journal := func(t *testing.T, c *Controller, p *Payment, created time.Time) (intent Intent) {
+		intent = Intent{
+			Payment:      p.Id,
+			Leg:          LegBeneficiary,
+			Receiver:     wallets.Address{Address: p.Receiver.Address, Index: p.Receiver.Index},
+			Destinations: []string{destination},
+			Amounts:      []uint64{amount},
+			Created:      created,
+		}
+		err := c.saveIntent(&intent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return intent
+	}
+
+	t.Run("Adopted", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet, p := setup(t)
+		intent := journal(t, &c, &p, time.Now())
+
+		transfer, err := wallet.Transfer(ctx, wallets.TransferRequest{SourceIndex: 0, Destination: destination, Amount: amount})
+		assertions.Nil(err, "failed to transfer")
+
+		err = c.resolve(ctx, &p, &intent)
+		assertions.Nil(err, "failed to resolve intent")
+		if assertions.NotNil(intent.Transfer, "transfer should be adopted") {
+			assertions.Equal(transfer.Address, intent.Transfer.Address, "invalid transaction")
+		}
+	})
+	t.Run("Amount", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet, p := setup(t)
+		intent := journal(t, &c, &p, time.Now())
+
+		_, err := wallet.Transfer(ctx, wallets.TransferRequest{SourceIndex: 0, Destination: destination, Amount: 2 * amount})
+		assertions.Nil(err, "failed to transfer")
+
+		err = c.resolve(ctx, &p, &intent)
+		assertions.Nil(err, "failed to resolve intent")
+		assertions.Nil(intent.Transfer, "transfers of other amounts can't be adopted")
+
+		_, found, err := c.intent(p.Id, LegBeneficiary)
+		assertions.Nil(err, "failed to retrieve intent")
+		assertions.False(found, "intents never made should be deleted")
+	})
+	t.Run("Before", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet, p := setup(t)
+
+		_, err := wallet.Transfer(ctx, wallets.TransferRequest{SourceIndex: 0, Destination: destination, Amount: amount})
+		assertions.Nil(err, "failed to transfer")
+
+		intent := journal(t, &c, &p, time.Now().Add(2*time.Second))
+
+		err = c.resolve(ctx, &p, &intent)
+		assertions.Nil(err, "failed to resolve intent")
+		assertions.Nil(intent.Transfer, "transfers made before the intent can't be adopted")
+	})
+	t.Run("Recycled", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet, p := setup(t)
+		intent := journal(t, &c, &p, time.Now().Add(-time.Minute))
+
+		// The previous owner of the receiver paid the same destination the same amount
+		payout, err := wallet.Transfer(ctx, wallets.TransferRequest{SourceIndex: 0, Destination: destination, Amount: amount})
+		assertions.Nil(err, "failed to transfer")
+
+		previous := Payment{
+			Id:          uuid.New(),
+			Receiver:    p.Receiver,
+			Beneficiary: Beneficiary{Transaction: payout.Address},
+		}
+		err = c.db.Update(func(txn *badger.Txn) (err error) {
+			err = txn.Set(PaymentKey(previous.Id), previous.Bytes())
+			if err != nil {
+				return err
+			}
+			return recordHistory(txn, &Recyclable{Receiver: p.Receiver, Payment: previous.Id})
+		})
+		assertions.Nil(err, "failed to recycle receiver")
+
+		err = c.resolve(ctx, &p, &intent)
+		assertions.Nil(err, "failed to resolve intent")
+		assertions.Nil(intent.Transfer, "payouts of previous owners can't be adopted")
+	})
+}
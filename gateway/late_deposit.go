@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Action taken over funds received after a payment was finalized
+type LateDepositPolicy string
+
+const (
+	// Forward the funds to the beneficiary discounting the fee
+	LateDepositForward LateDepositPolicy = "forward"
+	// Return the funds to the refund address of the payment
+	LateDepositRefund LateDepositPolicy = "refund"
+	// Leave the funds untouched until an operator reviews them
+	LateDepositReview LateDepositPolicy = "review"
+)
+
+func (p LateDepositPolicy) Validate() (err error) {
+	switch p {
+	case "", LateDepositForward, LateDepositRefund, LateDepositReview:
+		return nil
+	default:
+		return fmt.Errorf("unknown late deposit policy, expecting %s, %s or %s but got: %s", LateDepositForward, LateDepositRefund, LateDepositReview, p)
+	}
+}
+
+// Marks the payment as finalized so its receiver is watched for late deposits
+func (c *Controller) finalize(p Payment) (err error) {
+	return c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(FinalizedKey(p.Id), p.Id[:])
+		if err != nil {
+			return fmt.Errorf("failed to set finalized key: %w", err)
+		}
+		return nil
+	})
+}
+
+// Leg reported by the logs of the late deposits
+const LegLateDeposit = "late-deposit"
+
+// Records a failed attempt to move the late deposit. Deposits out of attempts are flagged for review
+func (c *Controller) lateDepositError(p *Payment, deposit LateDeposit, cause error) (err error) {
+	deposit.SetError(cause)
+	retry := c.registerAttempt(&deposit.Retry, cause)
+	if !retry {
+		deposit.Status = StatusFailed
+	}
+	p.LateDeposits = append(p.LateDeposits, deposit)
+
+	if retry {
+		err = c.savePaymentState(*p)
+		if err != nil {
+			return fmt.Errorf("failed to set save payment: %w", err)
+		}
+		return nil
+	}
+
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		return txn.Set(ReviewKey(p.Id), p.Id[:])
+	})
+	if err != nil {
+		return fmt.Errorf("failed to flag payment for review: %w", err)
+	}
+	return c.fail(p, LegLateDeposit, FinalizedKey(p.Id), cause)
+}
+
+func (c *Controller) processLateDeposit(ctx context.Context, p Payment, balances balances) (err error) {
+	// Deposits that failed to move are retried with their original action
+	var deposit LateDeposit
+	if last := len(p.LateDeposits) - 1; last >= 0 && p.LateDeposits[last].Status == StatusError {
+		deposit = p.LateDeposits[last]
+		if !deposit.Retry.ready(time.Now()) {
+			return nil
+		}
+		p.LateDeposits = p.LateDeposits[:last]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultTimeout)
+	defer cancel()
+
+	address, err := c.receiverState(ctx, &p, LegLateDeposit, balances)
+	if err != nil {
+		return fmt.Errorf("failed to get address: %w", err)
+	}
+
+	if address.Balance == 0 {
+		return nil
+	}
+
+	// We can wait for the rest of the money to arrive
+	if address.Balance > address.UnlockedBalance {
+		return nil
+	}
+
+	deposit.Amount = address.UnlockedBalance
+	if deposit.Detected.IsZero() {
+		deposit.Detected = time.Now()
+		deposit.Action = c.lateDepositPolicy
+	}
+	if deposit.Action == "" || (deposit.Action == LateDepositRefund && p.Refund.Address == "") {
+		deposit.Action = LateDepositReview
+	}
+
+	switch deposit.Action {
+	case LateDepositForward:
+		transfer, err := c.transfer(ctx, &p, LegLateDeposit, address, wallets.TransferRequest{
+			SourceIndex: p.Receiver.Index,
+			Destination: p.Beneficiary.Address,
+			Amount:      deposit.Amount - calculateFee(deposit.Amount, p.Fee.Percentage),
+			Priority:    p.Priority,
+			UnlockTime:  0,
+		})
+		if errors.Is(err, ErrAwaitingSignature) {
+			return nil
+		}
+		if err != nil {
+			return c.lateDepositError(&p, deposit, fmt.Errorf("failed to forward late deposit: %w", err))
+		}
+
+		deposit.Status = StatusCompleted
+		deposit.Payed = transfer.Amount
+		deposit.Transaction = transfer.Address
+	case LateDepositRefund:
+		sweep, err := c.sweep(ctx, &p, LegLateDeposit, address, wallets.SweepRequest{
+			SourceIndex: p.Receiver.Index,
+			Destination: p.Refund.Address,
+			Priority:    p.Priority,
+			UnlockTime:  0,
+		})
+		if errors.Is(err, ErrAwaitingSignature) {
+			return nil
+		}
+		if err != nil {
+			return c.lateDepositError(&p, deposit, fmt.Errorf("failed to refund late deposit: %w", err))
+		}
+
+		deposit.Status = StatusRefunded
+		deposit.Payed = sweep.Amount
+		deposit.Transaction = sweep.Address
+	case LateDepositReview:
+		deposit.Status = StatusReview
+	}
+	deposit.Error = ""
+
+	p.LateDeposits = append(p.LateDeposits, deposit)
+
+	err = c.savePaymentState(p)
+	if err != nil {
+		return fmt.Errorf("failed to set save payment: %w", err)
+	}
+
+	switch deposit.Action {
+	case LateDepositForward:
+		// The fee remains in the receiver. The fee processor sweeps it and finalizes the payment again
+		err = c.savePendingFee(p)
+		if err != nil {
+			return fmt.Errorf("failed to save pending fee: %w", err)
+		}
+	case LateDepositRefund:
+		err = c.recycle(p, deposit.Transaction)
+		if err != nil {
+			return fmt.Errorf("failed to recycle receiver: %w", err)
+		}
+		return nil
+	case LateDepositReview:
+		err = c.db.Update(func(txn *badger.Txn) (err error) {
+			return txn.Set(ReviewKey(p.Id), p.Id[:])
+		})
+		if err != nil {
+			return fmt.Errorf("failed to flag payment for review: %w", err)
+		}
+	}
+
+	err = c.deleteKey(FinalizedKey(p.Id))
+	if err != nil {
+		return fmt.Errorf("failed to delete finalized payment entry: %w", err)
+	}
+	return nil
+}
+
+// ProcessLateDeposits goes over the receivers of finalized payments looking for funds received after
+// the payment was finalized and handles them according to the late deposit policy
+func (c *Controller) ProcessLateDeposits(iteration context.Context) (processed uint64, err error) {
+	defer func(start time.Time) { c.metrics.Loop("late-deposits", start, processed) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(iteration, utils.DefaultTimeout)
+	defer cancel()
+
+	err = c.sync(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	payments, err := c.listPayments(finalizedPrefixBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+
+	balances, err := c.receiverBalances(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs = utils.NewJobPool(MaxConcurrentJobs)
+	var wg sync.WaitGroup
+	for _, payment := range payments {
+		// Canceled iterations stop dispatching payments
+		if iteration.Err() != nil {
+			break
+		}
+		processed++
+		jobs.Get()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jobs.Put()
+
+			err := c.processLateDeposit(iteration, payment, balances)
+			if err != nil {
+				c.paymentLogger(&payment, LegLateDeposit).Error("failed to process late deposit", logging.KeyError, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return processed, nil
+}
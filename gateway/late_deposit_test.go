@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ProcessLateDeposit(t *testing.T) {
+	t.Parallel()
+	assertions := assert.New(t)
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if !assertions.Nil(err, "failed to open database") {
+		return
+	}
+	defer db.Close()
+
+	c := New(Config{
+		DB:                db,
+		Wallet:            &failingWallet{Wallet: mock.New(mock.Config{})},
+		MaxAmount:         ^uint64(0),
+		LateDepositPolicy: LateDepositForward,
+		Retry: RetryConfig{
+			MaxAttempts: 2,
+			Backoff:     time.Millisecond,
+		},
+	})
+
+	// The funded address 0 of the mock plays the receiver of the finalized payment
+	p := Payment{
+		Id:          uuid.New(),
+		Receiver:    Receiver{Address: "mock_address_0", Index: 0},
+		Beneficiary: Beneficiary{Status: StatusCompleted, Address: "mock_beneficiary"},
+		Fee:         Fee{Status: StatusCompleted, Percentage: 10},
+	}
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(PaymentKey(p.Id), p.Bytes())
+		if err != nil {
+			return err
+		}
+		return txn.Set(FinalizedKey(p.Id), p.Id[:])
+	})
+	if !assertions.Nil(err, "failed to store payment") {
+		return
+	}
+
+	err = c.processLateDeposit(context.TODO(), p, nil)
+	assertions.Nil(err, "failed attempts should be saved")
+
+	p, err = c.Query(context.TODO(), p.Id)
+	assertions.Nil(err, "failed to query payment")
+	if !assertions.Len(p.LateDeposits, 1, "failed deposit should be recorded") {
+		return
+	}
+	assertions.Equal(StatusError, p.LateDeposits[0].Status, "failed attempts should be retried")
+	assertions.NotEmpty(p.LateDeposits[0].Error, "error should be recorded")
+	assertions.EqualValues(1, p.LateDeposits[0].Attempts, "attempt should be registered")
+
+	// Nothing is attempted before the backoff
+	err = c.processLateDeposit(context.TODO(), p, nil)
+	assertions.Nil(err, "deposit shouldn't be attempted during the backoff")
+
+	time.Sleep(10 * time.Millisecond)
+	err = c.processLateDeposit(context.TODO(), p, nil)
+	assertions.Nil(err, "exhausted deposits should be failed")
+
+	p, err = c.Query(context.TODO(), p.Id)
+	assertions.Nil(err, "failed to query payment")
+	if !assertions.Len(p.LateDeposits, 1, "retries should reuse the deposit") {
+		return
+	}
+	assertions.Equal(StatusFailed, p.LateDeposits[0].Status, "exhausted deposits should be failed")
+
+	finalized, err := c.listPayments(finalizedPrefixBytes)
+	assertions.Nil(err, "failed to list finalized payments")
+	assertions.Empty(finalized, "failed deposits should stop being watched")
+
+	review, err := c.listPayments(reviewPrefixBytes)
+	assertions.Nil(err, "failed to list payments under review")
+	assertions.Len(review, 1, "failed deposits should be flagged for review")
+}
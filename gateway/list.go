@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1_000
+)
+
+var ErrInvalidListRequest = errors.New("invalid list request")
+
+type ListRequest struct {
+	// Status of any of the legs of the payment. Every status when empty
+	Status Status
+	// Status of each leg. Ignored when empty
+	BeneficiaryStatus Status
+	FeeStatus         Status
+	RefundStatus      Status
+	// Payments created at or after this moment. Ignored when zero
+	From time.Time
+	// Payments created before this moment. Ignored when zero
+	To time.Time
+	// Payments expiring at or after this moment. Ignored when zero
+	ExpirationFrom time.Time
+	// Payments expiring before this moment. Ignored when zero
+	ExpirationTo time.Time
+	// Beneficiary address of the payments. Ignored when empty
+	Address string
+	// Amount range in atomic units. MaxAmount is ignored when zero
+	MinAmount uint64
+	MaxAmount uint64
+	// Only the payments of this merchant. Every merchant when nil
+	Merchant *uuid.UUID
+	// Maximum number of payments returned. Defaults to DefaultListLimit
+	Limit int
+	// Next value of a previous response to continue from
+	Cursor string
+}
+
+type ListResponse struct {
+	// Payments sorted by creation time
+	Payments []Payment
+	// Cursor of the next page. Empty in the last one
+	Next string
+}
+
+func (r *ListRequest) match(p *Payment) (ok bool) {
+	if r.Status != "" &&
+		p.Beneficiary.Status != r.Status &&
+		p.Fee.Status != r.Status &&
+		p.Refund.Status != r.Status {
+		return false
+	}
+	if r.BeneficiaryStatus != "" && p.Beneficiary.Status != r.BeneficiaryStatus {
+		return false
+	}
+	if r.FeeStatus != "" && p.Fee.Status != r.FeeStatus {
+		return false
+	}
+	if r.RefundStatus != "" && p.Refund.Status != r.RefundStatus {
+		return false
+	}
+	if !r.From.IsZero() && p.Created.Before(r.From) {
+		return false
+	}
+	if !r.To.IsZero() && !p.Created.Before(r.To) {
+		return false
+	}
+	if !r.ExpirationFrom.IsZero() && p.Expiration.Before(r.ExpirationFrom) {
+		return false
+	}
+	if !r.ExpirationTo.IsZero() && !p.Expiration.Before(r.ExpirationTo) {
+		return false
+	}
+	if r.Address != "" && p.Beneficiary.Address != r.Address {
+		return false
+	}
+	if p.Amount < r.MinAmount || (r.MaxAmount != 0 && p.Amount > r.MaxAmount) {
+		return false
+	}
+	if r.Merchant != nil && p.Merchant != *r.Merchant {
+		return false
+	}
+	return true
+}
+
+// Chooses the most selective index for the request
+func (r *ListRequest) index() (prefix []byte) {
+	switch {
+	case r.Address != "":
+		return BeneficiaryIndexPrefix(r.Address)
+	case r.BeneficiaryStatus != "":
+		return StatusIndexPrefix(LegBeneficiary, r.BeneficiaryStatus)
+	case r.FeeStatus != "":
+		return StatusIndexPrefix(LegFee, r.FeeStatus)
+	case r.RefundStatus != "":
+		return StatusIndexPrefix(LegRefund, r.RefundStatus)
+	case r.Merchant != nil:
+		return MerchantIndexPrefix(*r.Merchant)
+	default:
+		return CreatedIndexPrefix()
+	}
+}
+
+// List returns a page of the payments matching the request sorted by creation time
+func (c *Controller) List(ctx context.Context, req ListRequest) (res ListResponse, err error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		return res, fmt.Errorf("%w: limit should be at most %d", ErrInvalidListRequest, MaxListLimit)
+	}
+
+	prefix := req.index()
+	start := prefix
+	if req.Cursor != "" {
+		pos, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return res, fmt.Errorf("%w: %w", ErrInvalidListRequest, err)
+		}
+		start = append(append([]byte{}, prefix...), pos...)
+	}
+
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = prefix
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().Key()
+			// The cursor points to the last payment of the previous page
+			if req.Cursor != "" && string(key) == string(start) {
+				continue
+			}
+
+			var id uuid.UUID
+			err = it.Item().Value(func(val []byte) (err error) {
+				id, err = uuid.FromBytes(val)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to parse index entry: %w", err)
+			}
+
+			payment, err := getPayment(txn, id)
+			if err != nil {
+				return err
+			}
+			if !req.match(&payment) {
+				continue
+			}
+
+			if len(res.Payments) == limit {
+				res.Next = encodeCursor(&res.Payments[limit-1])
+				return nil
+			}
+			res.Payments = append(res.Payments, payment)
+		}
+		return nil
+	})
+	if err != nil {
+		return ListResponse{}, fmt.Errorf("failed to list payments: %w", err)
+	}
+	return res, nil
+}
+
+func getPayment(txn *badger.Txn, id uuid.UUID) (payment Payment, err error) {
+	item, err := txn.Get(PaymentKey(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return payment, ErrPaymentNotFound
+		}
+		return payment, fmt.Errorf("failed to get payment: %w", err)
+	}
+	err = item.Value(payment.FromBytes)
+	if err != nil {
+		return payment, fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+	return payment, nil
+}
@@ -0,0 +1,221 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMerchantNotFound = errors.New("merchant not found")
+	ErrInvalidApiKey    = errors.New("invalid api key")
+)
+
+// Random bytes of the generated API keys
+const apiKeySize = 32
+
+const (
+	merchantPrefix = "/merchant/"
+	apiKeyPrefix   = "/apikey/"
+)
+
+func MerchantKey(id uuid.UUID) (key []byte) {
+	return []byte(merchantPrefix + id.String())
+}
+
+// Maps the hash of an API key to its merchant
+func ApiKeyKey(hash string) (key []byte) {
+	return []byte(apiKeyPrefix + hash)
+}
+
+type (
+	MerchantWebhook struct {
+		// Secret used to sign the deliveries. Defaults to the one of the gateway
+		Secret string
+		// Url notified for payments created without one
+		CallbackUrl string
+	}
+	// Settings applied to the payments created by a merchant. Zero values fallback to the gateway ones
+	Merchant struct {
+		// Identifier of the merchant
+		Id uuid.UUID
+		// Human readable name
+		Name string
+		// Hex encoded SHA-256 of the API key
+		KeyHash string
+		// Percentage from 0 to 100 discounted from the payments
+		FeePercentage *uint64
+		// Minimum amount accepted
+		MinAmount uint64
+		// Maximum amount accepted
+		MaxAmount uint64
+		// Timeout until payment is canceled
+		Timeout time.Duration
+		// Beneficiary of the payments created without address
+		Address string
+		// Payment status notifications
+		Webhook MerchantWebhook
+	}
+)
+
+func (m *Merchant) Bytes() (bytes []byte) {
+	bytes, _ = json.Marshal(m)
+	return bytes
+}
+
+func (m *Merchant) FromBytes(b []byte) (err error) {
+	return json.Unmarshal(b, m)
+}
+
+func hashApiKey(apiKey string) (hash string) {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewMerchant registers a merchant and returns its API key. Only the hash of the key is stored
+func (c *Controller) NewMerchant(ctx context.Context, req Merchant) (merchant Merchant, apiKey string, err error) {
+	if req.FeePercentage != nil && *req.FeePercentage > 100 {
+		return merchant, "", errors.New("fee percentage should be between 0 and 100")
+	}
+	if req.MaxAmount != 0 && req.MinAmount > req.MaxAmount {
+		return merchant, "", errors.New("min amount should be less or equal than max amount")
+	}
+	if req.Address != "" {
+		err = c.wallet.ValidateAddress(ctx, wallets.ValidateAddressRequest{Address: req.Address})
+		if err != nil {
+			return merchant, "", fmt.Errorf("failed to validate address: %w", err)
+		}
+	}
+
+	var key [apiKeySize]byte
+	_, err = rand.Read(key[:])
+	if err != nil {
+		return merchant, "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	apiKey = hex.EncodeToString(key[:])
+
+	merchant = req
+	merchant.Id = uuid.New()
+	merchant.KeyHash = hashApiKey(apiKey)
+
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(MerchantKey(merchant.Id), merchant.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to set merchant: %w", err)
+		}
+		err = txn.Set(ApiKeyKey(merchant.KeyHash), merchant.Id[:])
+		if err != nil {
+			return fmt.Errorf("failed to set api key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return merchant, "", fmt.Errorf("failed to save merchant: %w", err)
+	}
+	return merchant, apiKey, nil
+}
+
+func getMerchant(txn *badger.Txn, id uuid.UUID) (merchant Merchant, err error) {
+	item, err := txn.Get(MerchantKey(id))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return merchant, ErrMerchantNotFound
+		}
+		return merchant, fmt.Errorf("failed to get merchant: %w", err)
+	}
+	err = item.Value(merchant.FromBytes)
+	if err != nil {
+		return merchant, fmt.Errorf("failed to unmarshal merchant: %w", err)
+	}
+	return merchant, nil
+}
+
+// Merchant retrieves a merchant by its id
+func (c *Controller) Merchant(ctx context.Context, id uuid.UUID) (merchant Merchant, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		merchant, err = getMerchant(txn, id)
+		return err
+	})
+	return merchant, err
+}
+
+// Authenticate returns the merchant owning the API key
+func (c *Controller) Authenticate(ctx context.Context, apiKey string) (merchant Merchant, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		item, err := txn.Get(ApiKeyKey(hashApiKey(apiKey)))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return ErrInvalidApiKey
+			}
+			return fmt.Errorf("failed to get api key: %w", err)
+		}
+
+		var id uuid.UUID
+		err = item.Value(func(val []byte) (err error) {
+			id, err = uuid.FromBytes(val)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read merchant id: %w", err)
+		}
+
+		merchant, err = getMerchant(txn, id)
+		return err
+	})
+	return merchant, err
+}
+
+// Settings used to create a payment
+type terms struct {
+	minAmount     uint64
+	maxAmount     uint64
+	timeout       time.Duration
+	feePercentage uint64
+}
+
+// Resolves the settings of the payments created by the merchant
+func (c *Controller) terms(m *Merchant) (t terms) {
+	t = terms{
+		minAmount:     c.minAmount,
+		maxAmount:     c.maxAmount,
+		timeout:       c.timeout,
+		feePercentage: c.feePercentage,
+	}
+	if m == nil {
+		return t
+	}
+	if m.MinAmount != 0 {
+		t.minAmount = m.MinAmount
+	}
+	if m.MaxAmount != 0 {
+		t.maxAmount = m.MaxAmount
+	}
+	if m.Timeout != 0 {
+		t.timeout = m.Timeout
+	}
+	if m.FeePercentage != nil {
+		t.feePercentage = *m.FeePercentage
+	}
+	return t
+}
+
+// QueryMerchant queries a payment only if it belongs to the merchant
+func (c *Controller) QueryMerchant(ctx context.Context, merchant, id uuid.UUID) (payment Payment, err error) {
+	payment, err = c.Query(ctx, id)
+	if err != nil {
+		return payment, err
+	}
+	if payment.Merchant != merchant {
+		return Payment{}, fmt.Errorf("faied to query entry from the database: %w", ErrPaymentNotFound)
+	}
+	return payment, nil
+}
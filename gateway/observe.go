@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Updates the status of a payment whose funds are not yet unlocked
+// Merchants are notified as soon as the transfers reach the pool and again once they are confirmed.
+// The transfers are queried when the caller didn't read them in batch
+func (c *Controller) observe(ctx context.Context, p *Payment, address *wallets.Address, incoming incoming) (err error) {
+	transfers := incoming[p.Receiver.Index]
+	if incoming == nil {
+		transfers, err = c.wallet.IncomingTransfers(ctx, wallets.IncomingTransfersRequest{Index: p.Receiver.Index, Pool: true})
+		if err != nil {
+			return fmt.Errorf("failed to retrieve incoming transfers: %w", err)
+		}
+	}
+
+	status := p.Beneficiary.Status
+	pool, seen := c.seen(p, transfers)
+
+	switch {
+	case address.Balance > address.UnlockedBalance && c.confirmed(p, address, transfers):
+		p.Beneficiary.Status = StatusConfirmed
+	case p.Beneficiary.Status == StatusPending && address.UnlockedBalance < p.Amount && address.Balance+pool >= p.Amount:
+		p.Beneficiary.Status = StatusSeen
+	}
+
+	if !seen && status == p.Beneficiary.Status {
+		return nil
+	}
+
+	err = c.savePaymentState(*p)
+	if err != nil {
+		return fmt.Errorf("failed to set save payment: %w", err)
+	}
+	return nil
+}
+
+// Records the transfers found in the pool. pool is the amount still waiting to be mined,
+// the balance excludes it
+func (c *Controller) seen(p *Payment, transfers []wallets.IncomingTransfer) (pool uint64, changed bool) {
+	for _, transfer := range transfers {
+		if !transfer.InPool {
+			continue
+		}
+		pool += transfer.Amount
+
+		if slices.Contains(p.Seen.Transactions, transfer.TransactionId) {
+			continue
+		}
+		p.Seen.Amount += transfer.Amount
+		p.Seen.Transactions = append(p.Seen.Transactions, transfer.TransactionId)
+		changed = true
+	}
+	return pool, changed
+}
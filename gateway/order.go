@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+// Bounds of the merchant supplied references
+const (
+	MaxOrderIdLength       = 255
+	MaxMetadataEntries     = 20
+	MaxMetadataKeyLength   = 40
+	MaxMetadataValueLength = 500
+)
+
+const orderPrefix = "/order/"
+
+// Prefix of the payments of an order
+func OrderPrefix(merchant uuid.UUID, orderId string) (prefix []byte) {
+	return []byte(orderPrefix + merchant.String() + "/" + orderId + "/")
+}
+
+// Index of the payments created for an order of the merchant
+func OrderKey(merchant uuid.UUID, orderId string, id uuid.UUID) (key []byte) {
+	return append(OrderPrefix(merchant, orderId), id.String()...)
+}
+
+func validateReferences(orderId string, metadata map[string]string) (err error) {
+	if len(orderId) > MaxOrderIdLength {
+		return fmt.Errorf("order id should be at most %d characters", MaxOrderIdLength)
+	}
+	if len(metadata) > MaxMetadataEntries {
+		return fmt.Errorf("metadata should have at most %d entries", MaxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if key == "" || len(key) > MaxMetadataKeyLength {
+			return fmt.Errorf("metadata keys should have between 1 and %d characters: %q", MaxMetadataKeyLength, key)
+		}
+		if len(value) > MaxMetadataValueLength {
+			return fmt.Errorf("metadata values should be at most %d characters: %q", MaxMetadataValueLength, key)
+		}
+	}
+	return nil
+}
+
+// FindByOrder returns the payments the merchant created for the order sorted by creation time
+func (c *Controller) FindByOrder(ctx context.Context, merchant uuid.UUID, orderId string) (payments []Payment, err error) {
+	if orderId == "" {
+		return nil, errors.New("order id is required")
+	}
+
+	prefix := OrderPrefix(merchant, orderId)
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = prefix
+		options.PrefetchValues = false
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			id, err := uuid.ParseBytes(it.Item().Key()[len(prefix):])
+			if err != nil {
+				// Order ids containing the separator share the prefix of shorter ones
+				continue
+			}
+
+			item, err := txn.Get(PaymentKey(id))
+			if err != nil {
+				return fmt.Errorf("failed to get payment: %w", err)
+			}
+
+			var payment Payment
+			err = item.Value(payment.FromBytes)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal payment: %w", err)
+			}
+			if payment.OrderId != orderId || payment.Merchant != merchant {
+				continue
+			}
+			payments = append(payments, payment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find payments of order: %w", err)
+	}
+
+	slices.SortFunc(payments, func(a, b Payment) int { return a.Created.Compare(b.Created) })
+	return payments, nil
+}
@@ -2,8 +2,10 @@ package gateway
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/RogueTeam/8ball/decimal"
 	"github.com/RogueTeam/8ball/wallets"
 	"github.com/google/uuid"
 )
@@ -12,27 +14,52 @@ type Status string
 
 const (
 	StatusPending            Status = "pending"
+	StatusSeen               Status = "seen"
+	StatusConfirmed          Status = "confirmed"
 	StatusCompleted          Status = "completed"
 	StatusPartiallyCompleted Status = "partially-completed"
 	StatusExpired            Status = "expired"
 	StatusError              Status = "error"
+	StatusRefunded           Status = "refunded"
+	StatusReview             Status = "review"
+	StatusCanceled           Status = "canceled"
+	// The leg won't be retried until an operator intervenes
+	StatusFailed Status = "failed"
+	// The transfer of the leg waits to be signed offline
+	StatusAwaitingSignature Status = "awaiting-signature"
 )
 
 const (
-	feePrefix      = "/fee/"
-	pendingPrefix  = "/pending/"
-	paymentsPrefix = "/payment/"
+	feePrefix       = "/fee/"
+	refundPrefix    = "/refund/"
+	pendingPrefix   = "/pending/"
+	paymentsPrefix  = "/payment/"
+	webhookPrefix   = "/webhook/"
+	recyclePrefix   = "/recycle/"
+	receiverPrefix  = "/receiver/"
+	finalizedPrefix = "/finalized/"
+	reviewPrefix    = "/review/"
+	historyPrefix   = "/history/"
 )
 
 var (
-	pendingPrefixBytes = []byte(pendingPrefix)
-	feePrefixBytes     = []byte(feePrefix)
+	pendingPrefixBytes   = []byte(pendingPrefix)
+	feePrefixBytes       = []byte(feePrefix)
+	refundPrefixBytes    = []byte(refundPrefix)
+	webhookPrefixBytes   = []byte(webhookPrefix)
+	recyclePrefixBytes   = []byte(recyclePrefix)
+	finalizedPrefixBytes = []byte(finalizedPrefix)
+	reviewPrefixBytes    = []byte(reviewPrefix)
 )
 
 func FeeKey(id uuid.UUID) (key []byte) {
 	return []byte(feePrefix + id.String())
 }
 
+func RefundKey(id uuid.UUID) (key []byte) {
+	return []byte(refundPrefix + id.String())
+}
+
 func PendingKey(id uuid.UUID) (key []byte) {
 	return []byte(pendingPrefix + id.String())
 }
@@ -41,6 +68,35 @@ func PaymentKey(id uuid.UUID) (key []byte) {
 	return []byte(paymentsPrefix + id.String())
 }
 
+func WebhookKey(id uuid.UUID) (key []byte) {
+	return []byte(webhookPrefix + id.String())
+}
+
+// Recycle keys are sorted by the moment the receiver becomes available
+func RecycleKey(available time.Time, index uint64) (key []byte) {
+	return fmt.Appendf(nil, "%s%020d/%020d", recyclePrefix, available.UnixNano(), index)
+}
+
+// Points to the last payment that used the receiver
+func ReceiverKey(index uint64) (key []byte) {
+	return fmt.Appendf(nil, "%s%020d", receiverPrefix, index)
+}
+
+// Transactions recorded by the previous owners of the receiver
+func HistoryKey(index uint64) (key []byte) {
+	return fmt.Appendf(nil, "%s%020d", historyPrefix, index)
+}
+
+// Payments whose receiver is watched for late deposits
+func FinalizedKey(id uuid.UUID) (key []byte) {
+	return []byte(finalizedPrefix + id.String())
+}
+
+// Payments with late deposits waiting for an operator
+func ReviewKey(id uuid.UUID) (key []byte) {
+	return []byte(reviewPrefix + id.String())
+}
+
 type (
 	Receiver struct {
 		// Address that will receive the funds
@@ -53,6 +109,8 @@ type (
 		Status Status
 		// Error message
 		Error string
+		// Failed attempts
+		Retry
 		// Address of the beneficiary during this transaction
 		Address string
 		// Actual amount payed to the Beneficiary
@@ -65,6 +123,8 @@ type (
 		Status Status
 		// Error message
 		Error string
+		// Failed attempts
+		Retry
 		// Percentage to be payed
 		Percentage uint64
 		// Address of the account that will the fee profit
@@ -74,13 +134,73 @@ type (
 		// Transaction that was used to pay the fee
 		Transaction string
 	}
+	Quote struct {
+		// Currency the payment was priced in
+		Currency string
+		// Price of the payment expressed in the currency
+		Amount decimal.Decimal
+		// Price of a single XMR in the currency at the moment of the creation
+		Rate decimal.Decimal
+		// The rate is honored until the payment expires
+		Expiration time.Time
+	}
+	Seen struct {
+		// Amount of the transfers seen in the pool
+		Amount uint64
+		// Transactions seen in the pool
+		Transactions []string
+	}
+	Refund struct {
+		// Status of the refund. Empty when nothing has to be refunded
+		Status Status
+		// Error message
+		Error string
+		// Failed attempts
+		Retry
+		// Address receiving the funds returned to the payer
+		Address string
+		// Amount to return. Underpayments return the entire balance of the receiver
+		Amount uint64
+		// Actual amount returned to the payer
+		Payed uint64
+		// Transaction used to return the funds
+		Transaction string
+	}
+	LateDeposit struct {
+		// Amount received after the payment was finalized
+		Amount uint64
+		// Moment the deposit was detected
+		Detected time.Time
+		// Action taken over the funds
+		Action LateDepositPolicy
+		// Status of the action
+		Status Status
+		// Error message
+		Error string
+		// Failed attempts
+		Retry
+		// Amount forwarded or refunded
+		Payed uint64
+		// Transaction used to move the funds
+		Transaction string
+	}
 	Payment struct {
 		// Identifier of the transaction
 		Id uuid.UUID
+		// Merchant that created the payment. Nil for payments created without one
+		Merchant uuid.UUID
+		// Reference of the payment in the order system of the merchant
+		OrderId string
+		// Free-form data attached by the merchant
+		Metadata map[string]string
+		// Creation time of the payment
+		Created time.Time
 		// Priority to forward funds to beneficiary
 		Priority wallets.Priority
 		// Overall amount to expect from the transaction
 		Amount uint64
+		// Exchange rate used when the payment was priced in other currency
+		Quote *Quote
 		// Expiration time of the payment
 		Expiration time.Time
 		// The receiver is the address used to receive the payment
@@ -89,6 +209,14 @@ type (
 		Fee Fee
 		// Beneficiary information. Stored in case wallet changes
 		Beneficiary Beneficiary
+		// Transfers detected before being mined
+		Seen Seen
+		// Url notified on every status change of the payment
+		CallbackUrl string
+		// Refund details
+		Refund Refund
+		// Funds received after the payment was finalized
+		LateDeposits []LateDeposit
 	}
 )
 
@@ -110,6 +238,24 @@ func (f *Fee) SetError(err error) {
 	f.Error = err.Error()
 }
 
+func (r *Refund) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	r.Status = StatusError
+	r.Error = err.Error()
+}
+
+func (d *LateDeposit) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	d.Status = StatusError
+	d.Error = err.Error()
+}
+
 func (p *Payment) Bytes() (bytes []byte) {
 	bytes, _ = json.Marshal(p)
 	return bytes
@@ -1,22 +1,30 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
+	"time"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/RogueTeam/8ball/utils"
 	"github.com/RogueTeam/8ball/wallets"
 )
 
-func (c *Controller) processFee(p Payment) (err error) {
+func (c *Controller) processFee(ctx context.Context, p Payment, balances balances) (err error) {
 	// cc, _ := json.MarshalIndent(p, "", "\t")
 	// log.Println("Processing fee:", string(cc))
 
-	ctx, cancel := utils.NewContext()
+	// Waiting for the next attempt after a wallet error
+	if !p.Fee.Retry.ready(time.Now()) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultTimeout)
 	defer cancel()
 
-	address, err := c.getReceiverAddress(ctx, p.Receiver)
+	address, err := c.receiverState(ctx, &p, LegFee, balances)
 	if err != nil {
 		return fmt.Errorf("failed to get address: %w", err)
 	}
@@ -30,15 +38,22 @@ func (c *Controller) processFee(p Payment) (err error) {
 		return nil
 	}
 
-	sweep, err := c.wallet.SweepAll(ctx, wallets.SweepRequest{
+	sweep, err := c.sweep(ctx, &p, LegFee, address, wallets.SweepRequest{
 		SourceIndex: p.Receiver.Index,
 		Destination: p.Fee.Address,
 		Priority:    p.Priority,
 		UnlockTime:  0,
 	})
+	if errors.Is(err, ErrAwaitingSignature) {
+		return c.awaitSignature(&p, &p.Fee.Status)
+	}
 	if err != nil {
 		err = fmt.Errorf("failed to transfer funds: %w", err)
 		p.Fee.SetError(err)
+		if !c.registerAttempt(&p.Fee.Retry, err) {
+			p.Fee.Status = StatusFailed
+			return c.fail(&p, LegFee, FeeKey(p.Id), err)
+		}
 
 		err = c.savePaymentState(p)
 		if err != nil {
@@ -47,7 +62,8 @@ func (c *Controller) processFee(p Payment) (err error) {
 		return err
 	}
 
-	p.Fee.Payed = sweep.Amount
+	// Late deposits forwarded to the beneficiary leave more fees on the receiver
+	p.Fee.Payed += sweep.Amount
 	p.Fee.Transaction = sweep.Address
 	p.Fee.Status = StatusCompleted
 
@@ -59,17 +75,47 @@ func (c *Controller) processFee(p Payment) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to delete pending payment entry: %w", err)
 	}
+
+	err = c.finalize(p)
+	if err != nil {
+		return fmt.Errorf("failed to finalize payment: %w", err)
+	}
+
+	err = c.recycle(p, sweep.Address)
+	if err != nil {
+		return fmt.Errorf("failed to recycle receiver: %w", err)
+	}
 	return nil
 }
 
-func (c *Controller) ProcessPendingFees() (processed uint64, err error) {
-	payments, errChan := c.streamPayments(feePrefixBytes)
-	defer utils.ConsumeChannel(payments)
-	defer utils.ConsumeChannel(errChan)
+func (c *Controller) ProcessPendingFees(iteration context.Context) (processed uint64, err error) {
+	defer func(start time.Time) { c.metrics.Loop("fees", start, processed) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(iteration, utils.DefaultTimeout)
+	defer cancel()
+
+	err = c.sync(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	payments, err := c.listPayments(feePrefixBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+
+	balances, err := c.receiverBalances(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
 
 	var jobs = utils.NewJobPool(MaxConcurrentJobs)
 	var wg sync.WaitGroup
-	for payment := range payments {
+	for _, payment := range payments {
+		// Canceled iterations stop dispatching payments
+		if iteration.Err() != nil {
+			break
+		}
 		processed++
 		jobs.Get()
 		wg.Add(1)
@@ -77,18 +123,13 @@ func (c *Controller) ProcessPendingFees() (processed uint64, err error) {
 			defer wg.Done()
 			defer jobs.Put()
 
-			err := c.processFee(payment)
+			err := c.processFee(iteration, payment, balances)
 			if err != nil {
-				log.Printf("failed to process fee payment: %v: %v", payment.Id, err)
+				c.paymentLogger(&payment, LegFee).Error("failed to process fee", logging.KeyError, err)
 			}
 		}()
 	}
 
 	wg.Wait()
-
-	err = <-errChan
-	if err != nil {
-		return processed, fmt.Errorf("failed to retrieve jobs: %w", err)
-	}
 	return processed, nil
 }
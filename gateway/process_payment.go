@@ -1,29 +1,45 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/metrics"
 	"github.com/RogueTeam/8ball/utils"
 	"github.com/RogueTeam/8ball/wallets"
 )
 
-func (c *Controller) processPayment(p Payment) (err error) {
+func (c *Controller) processPayment(ctx context.Context, p Payment, balances balances, incoming incoming) (err error) {
 	now := time.Now()
 
 	// cc, _ := json.MarshalIndent(p, "", "\t")
 	// log.Println("Processing payment:", string(cc))
 
-	ctx, cancel := utils.NewContext()
+	// Waiting for the next attempt after a wallet error
+	if !p.Beneficiary.Retry.ready(now) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultTimeout)
 	defer cancel()
 
-	address, err := c.getReceiverAddress(ctx, p.Receiver)
+	address, err := c.receiverState(ctx, &p, LegBeneficiary, balances)
 	if err != nil {
 		return fmt.Errorf("failed to get address: %w", err)
 	}
 
+	// Only unlocked funds are forwarded. Meanwhile the merchant is kept up to date
+	if p.Beneficiary.Status == StatusPending || p.Beneficiary.Status == StatusSeen {
+		err = c.observe(ctx, &p, &address, incoming)
+		if err != nil {
+			return fmt.Errorf("failed to observe transfers: %w", err)
+		}
+	}
+
 	// We can wait for the rest of the money to arrive
 	if address.Balance > address.UnlockedBalance {
 		return nil
@@ -42,17 +58,48 @@ func (c *Controller) processPayment(p Payment) (err error) {
 	// The account was found with funds so:
 	// - If it is live. Funds are complete
 	// - If expired it may have incomplete funds
-	if address.UnlockedBalance > 0 {
-		transfer, err := c.wallet.Transfer(ctx, wallets.TransferRequest{
-			SourceIndex: p.Receiver.Index,
-			Destination: p.Beneficiary.Address,
-			Amount:      address.UnlockedBalance - calculateFee(address.UnlockedBalance, p.Fee.Percentage),
-			Priority:    p.Priority,
-			UnlockTime:  0,
-		})
+	if address.UnlockedBalance > 0 && c.refundUnderpaid(&p, address.UnlockedBalance) {
+		// Nothing is forwarded. The payer receives back the entire balance
+		p.Beneficiary.Status = StatusRefunded
+		p.Fee.Status = StatusRefunded
+		p.Refund.Status = StatusPending
+		p.Refund.Amount = address.UnlockedBalance
+
+		err = c.savePendingRefund(p)
+		if err != nil {
+			return fmt.Errorf("failed to save pending refund: %w", err)
+		}
+	} else if address.UnlockedBalance > 0 {
+		excess := c.refundOverpaid(&p, address.UnlockedBalance)
+		received := address.UnlockedBalance - excess
+
+		// The excess needs its own transaction so only exact payments are settled at once
+		var settled bool
+		if excess == 0 {
+			settled, err = c.settle(ctx, &p, address, received)
+		}
+		if err == nil && !settled {
+			var transfer wallets.Transfer
+			transfer, err = c.transfer(ctx, &p, LegBeneficiary, address, wallets.TransferRequest{
+				SourceIndex: p.Receiver.Index,
+				Destination: p.Beneficiary.Address,
+				Amount:      received - calculateFee(received, p.Fee.Percentage),
+				Priority:    p.Priority,
+				UnlockTime:  0,
+			})
+			p.Beneficiary.Payed = transfer.Amount
+			p.Beneficiary.Transaction = transfer.Address
+		}
+		if errors.Is(err, ErrAwaitingSignature) {
+			return c.awaitSignature(&p, &p.Beneficiary.Status)
+		}
 		if err != nil {
 			err = fmt.Errorf("failed to transfer funds: %w", err)
 			p.Beneficiary.SetError(err)
+			if !c.registerAttempt(&p.Beneficiary.Retry, err) {
+				p.Beneficiary.Status = StatusFailed
+				return c.fail(&p, LegBeneficiary, PendingKey(p.Id), err)
+			}
 
 			err = c.savePaymentState(p)
 			if err != nil {
@@ -61,22 +108,35 @@ func (c *Controller) processPayment(p Payment) (err error) {
 			return err
 		}
 
-		p.Beneficiary.Payed = transfer.Amount
-		p.Beneficiary.Transaction = transfer.Address
-
 		if address.UnlockedBalance >= p.Amount {
 			p.Beneficiary.Status = StatusCompleted
 		} else {
 			p.Beneficiary.Status = StatusPartiallyCompleted
 		}
-		err = c.savePendingFee(p)
-		if err != nil {
-			return fmt.Errorf("failed to save pending fee: %w", err)
+
+		switch {
+		case excess > 0:
+			// The fee is collected after returning the excess
+			p.Refund.Status = StatusPending
+			p.Refund.Amount = excess
+
+			err = c.savePendingRefund(p)
+			if err != nil {
+				return fmt.Errorf("failed to save pending refund: %w", err)
+			}
+		case settled:
+			// Nothing left in the receiver
+		default:
+			err = c.savePendingFee(p)
+			if err != nil {
+				return fmt.Errorf("failed to save pending fee: %w", err)
+			}
 		}
 	} else {
 		p.Beneficiary.Status = StatusExpired
 		p.Fee.Status = StatusExpired
 	}
+	c.metrics.Amount(metrics.AmountReceived, address.UnlockedBalance)
 
 	err = c.savePaymentState(p)
 	if err != nil {
@@ -86,20 +146,60 @@ func (c *Controller) processPayment(p Payment) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to delete pending payment entry: %w", err)
 	}
+
+	if p.Beneficiary.Status == StatusExpired || p.Fee.Status == StatusCompleted {
+		err = c.finalize(p)
+		if err != nil {
+			return fmt.Errorf("failed to finalize payment: %w", err)
+		}
+
+		err = c.recycle(p, p.Fee.Transaction)
+		if err != nil {
+			return fmt.Errorf("failed to recycle receiver: %w", err)
+		}
+	}
 	return nil
 }
 
 const MaxConcurrentJobs = 1_000
 
 // ProcessPendingPayments is a function that goes over all pending payments and checks if the payment was executed
-func (c *Controller) ProcessPendingPayments() (processed uint64, err error) {
-	payments, errChan := c.streamPayments(pendingPrefixBytes)
-	defer utils.ConsumeChannel(payments)
-	defer utils.ConsumeChannel(errChan)
+func (c *Controller) ProcessPendingPayments(iteration context.Context) (processed uint64, err error) {
+	defer func(start time.Time) { c.metrics.Loop("payments", start, processed) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(iteration, utils.DefaultTimeout)
+	defer cancel()
+
+	err = c.sync(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.pending.Lock()
+	defer c.pending.Unlock()
+
+	payments, err := c.listPayments(pendingPrefixBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+
+	balances, err := c.receiverBalances(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
+
+	incoming, err := c.receiverIncoming(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
 
 	var jobs = utils.NewJobPool(MaxConcurrentJobs)
 	var wg sync.WaitGroup
-	for payment := range payments {
+	for _, payment := range payments {
+		// Canceled iterations stop dispatching payments
+		if iteration.Err() != nil {
+			break
+		}
 		processed++
 		jobs.Get()
 		wg.Add(1)
@@ -107,18 +207,13 @@ func (c *Controller) ProcessPendingPayments() (processed uint64, err error) {
 			defer wg.Done()
 			defer jobs.Put()
 
-			err := c.processPayment(payment)
+			err := c.processPayment(iteration, payment, balances, incoming)
 			if err != nil {
-				log.Printf("failed to process beneficiary payment: %v: %v", payment.Id, err)
+				c.paymentLogger(&payment, LegBeneficiary).Error("failed to process payment", logging.KeyError, err)
 			}
 		}()
 	}
 
 	wg.Wait()
-
-	err = <-errChan
-	if err != nil {
-		return processed, fmt.Errorf("failed to retrieve jobs: %w", err)
-	}
 	return processed, nil
 }
@@ -2,8 +2,8 @@ package gateway
 
 import (
 	"fmt"
-	"log"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 )
@@ -12,6 +12,15 @@ func calculateFee(amount, feePercentage uint64) (fee uint64) {
 	return (amount * feePercentage) / 100
 }
 
+// Collects the queued payments so their receivers can be read in a single batch
+func (c *Controller) listPayments(prefix []byte) (payments []Payment, err error) {
+	stream, errChan := c.streamPayments(prefix)
+	for payment := range stream {
+		payments = append(payments, payment)
+	}
+	return payments, <-errChan
+}
+
 // Streams pending payments into a channel. Its intended be used in parallel while querying wallets
 // payments channel should must be consumed at all
 func (c *Controller) streamPayments(prefix []byte) (payments chan Payment, err chan error) {
@@ -39,14 +48,14 @@ func (c *Controller) streamPayments(prefix []byte) (payments chan Payment, err c
 				})
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment id: %w", err)
-					log.Println(err) // We can't return but even then we need to try the others
+					c.logger.Error("failed to stream payment", logging.KeyError, err) // We can't return but even then we need to try the others
 					continue
 				}
 
 				paymentItem, err := txn.Get(PaymentKey(id))
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment: %w", err)
-					log.Println(err)
+					c.logger.Error("failed to stream payment", logging.KeyError, err)
 					continue
 				}
 
@@ -59,7 +68,7 @@ func (c *Controller) streamPayments(prefix []byte) (payments chan Payment, err c
 				})
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment: %w", err)
-					log.Println(err) // We can't return but even then we need to try the others
+					c.logger.Error("failed to stream payment", logging.KeyError, err) // We can't return but even then we need to try the others
 					continue
 				}
 
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/oracles"
+)
+
+var ErrOracleNotConfigured = errors.New("no price oracle configured")
+
+// Converts the price of the request into atomic units using the current exchange rate
+// The amount is rounded up so the beneficiary never receives less than the price
+func (c *Controller) quote(ctx context.Context, req *Receive) (amount uint64, quote *Quote, err error) {
+	if c.oracle == nil {
+		return 0, nil, ErrOracleNotConfigured
+	}
+
+	if req.Price.Value == nil || req.Price.Value.Sign() <= 0 {
+		return 0, nil, errors.New("price should be greater than zero")
+	}
+
+	rate, err := c.oracle.Rate(ctx, oracles.RateRequest{Currency: req.Currency})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to retrieve exchange rate: %w", err)
+	}
+
+	if rate.Price.Value == nil || rate.Price.Value.Sign() <= 0 {
+		return 0, nil, fmt.Errorf("invalid exchange rate for currency: %s", rate.Currency)
+	}
+
+	xmr := big.NewFloat(0).SetMode(decimal.RoundingMode).SetPrec(decimal.OperationPrec)
+	xmr.Quo(req.Price.Value, rate.Price.Value)
+	xmr.Mul(xmr, decimal.MoneroAsBigFloat)
+
+	amount, accuracy := xmr.Uint64()
+	if accuracy == big.Below {
+		amount++
+	}
+
+	quote = &Quote{
+		Currency: rate.Currency,
+		Amount:   req.Price,
+		Rate:     rate.Price,
+	}
+	return amount, quote, nil
+}
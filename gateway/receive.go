@@ -2,26 +2,50 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/RogueTeam/8ball/wallets"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 )
 
+// Attempts to create a payment when concurrent receives took the same recycled receiver
+const maxConflictRetries = 3
+
 type Receive struct {
-	Address  string
+	Address string
+	// Amount in atomic units. Ignored when Currency is set
 	Amount   uint64
 	Priority wallets.Priority
+	// Optional currency of Price. The amount is calculated with the exchange rate of the oracle
+	Currency string
+	// Price of the payment expressed in Currency
+	Price decimal.Decimal
+	// Optional url notified on every status change of the payment
+	CallbackUrl string
+	// Optional address receiving refunded funds
+	RefundAddress string
+	// Optional merchant creating the payment. Its settings override the gateway ones
+	Merchant uuid.UUID
+	// Optional key making repeated requests return the payment created by the first one
+	IdempotencyKey string
+	// Optional reference of the payment in the order system of the merchant
+	OrderId string
+	// Optional free-form data stored with the payment
+	Metadata map[string]string
 }
 
-func (c *Controller) validateReceive(ctx context.Context, r *Receive) (err error) {
-	if r.Amount < c.minAmount {
-		return fmt.Errorf("amount should be greater or equal than: %d", c.minAmount)
+func (c *Controller) validateReceive(ctx context.Context, r *Receive, t *terms) (err error) {
+	if r.Amount < t.minAmount {
+		return fmt.Errorf("amount should be greater or equal than: %d", t.minAmount)
 	}
-	if r.Amount > c.maxAmount {
-		return fmt.Errorf("amount should be less or equal than: %d", c.maxAmount)
+	if r.Amount > t.maxAmount {
+		return fmt.Errorf("amount should be less or equal than: %d", t.maxAmount)
 	}
 
 	err = r.Priority.Validate()
@@ -29,10 +53,32 @@ func (c *Controller) validateReceive(ctx context.Context, r *Receive) (err error
 		return fmt.Errorf("invalid priority: %w", err)
 	}
 
+	err = validateReferences(r.OrderId, r.Metadata)
+	if err != nil {
+		return fmt.Errorf("invalid references: %w", err)
+	}
+
 	err = c.wallet.ValidateAddress(ctx, wallets.ValidateAddressRequest{Address: r.Address})
 	if err != nil {
 		return fmt.Errorf("failed to validate address: %w", err)
 	}
+
+	if r.RefundAddress != "" {
+		err = c.wallet.ValidateAddress(ctx, wallets.ValidateAddressRequest{Address: r.RefundAddress})
+		if err != nil {
+			return fmt.Errorf("failed to validate refund address: %w", err)
+		}
+	}
+
+	if r.CallbackUrl != "" {
+		u, err := url.Parse(r.CallbackUrl)
+		if err != nil {
+			return fmt.Errorf("invalid callback url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("callback url should be an absolute http or https url: %s", r.CallbackUrl)
+		}
+	}
 	return nil
 }
 
@@ -41,37 +87,148 @@ func (c *Controller) validateReceive(ctx context.Context, r *Receive) (err error
 // id is the id to be used for future checks
 // fee is the percentage to be discounted from the entire transaction
 func (c *Controller) Receive(ctx context.Context, req *Receive) (payment Payment, err error) {
-	err = c.validateReceive(ctx, req)
+	var hash string
+	if req.IdempotencyKey != "" {
+		if len(req.IdempotencyKey) > MaxIdempotencyKeyLength {
+			return payment, fmt.Errorf("idempotency key should be at most %d characters", MaxIdempotencyKeyLength)
+		}
+		hash = req.hash()
+
+		// Retries return the payment without quoting or validating the request again
+		var replayed bool
+		err = c.db.View(func(txn *badger.Txn) (err error) {
+			payment, replayed, err = c.replay(txn, req, hash)
+			return err
+		})
+		if err != nil {
+			return payment, fmt.Errorf("failed to replay payment: %w", err)
+		}
+		if replayed {
+			return payment, nil
+		}
+	}
+
+	var merchant *Merchant
+	if req.Merchant != uuid.Nil {
+		m, err := c.Merchant(ctx, req.Merchant)
+		if err != nil {
+			return payment, fmt.Errorf("failed to retrieve merchant: %w", err)
+		}
+		merchant = &m
+
+		withDefaults := *req
+		if withDefaults.Address == "" {
+			withDefaults.Address = m.Address
+		}
+		if withDefaults.CallbackUrl == "" {
+			withDefaults.CallbackUrl = m.Webhook.CallbackUrl
+		}
+		req = &withDefaults
+	}
+	t := c.terms(merchant)
+
+	var quote *Quote
+	if req.Currency != "" {
+		converted := *req
+		converted.Amount, quote, err = c.quote(ctx, req)
+		if err != nil {
+			return payment, fmt.Errorf("failed to quote price: %w", err)
+		}
+		req = &converted
+	}
+
+	err = c.validateReceive(ctx, req, &t)
 	if err != nil {
 		return payment, fmt.Errorf("failed to validate request: %w", err)
 	}
 
+	// Receiver created by a conflicted attempt. Reused by the next ones so no account is wasted
+	var created *Receiver
+	for range maxConflictRetries {
+		payment, err = c.receive(ctx, req, &t, quote, hash, &created)
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	if created != nil && (err != nil || payment.Receiver != *created) {
+		releaseErr := c.release(*created)
+		if releaseErr != nil {
+			c.logger.Error("failed to release unused receiver", logging.KeyReceiver, created.Index, logging.KeyError, releaseErr)
+		}
+	}
+	if err != nil {
+		return payment, fmt.Errorf("failed to add entry to the database: %w", err)
+	}
+	return payment, nil
+}
+
+func (c *Controller) receive(ctx context.Context, req *Receive, t *terms, quote *Quote, hash string, created **Receiver) (payment Payment, err error) {
+	var replayed bool
 	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		if req.IdempotencyKey != "" {
+			payment, replayed, err = c.replay(txn, req, hash)
+			if err != nil || replayed {
+				return err
+			}
+		}
+
+		now := time.Now()
 		payment = Payment{
 			Id:         uuid.New(),
+			Merchant:   req.Merchant,
+			OrderId:    req.OrderId,
+			Metadata:   req.Metadata,
 			Priority:   req.Priority,
 			Amount:     req.Amount,
-			Expiration: time.Now().Add(c.timeout),
+			Created:    now,
+			Expiration: now.Add(t.timeout),
 			Fee: Fee{
 				Status:     StatusPending,
-				Percentage: c.feePercentage,
+				Percentage: t.feePercentage,
 				Address:    c.address,
 			},
 			Beneficiary: Beneficiary{
 				Status:  StatusPending,
 				Address: req.Address,
 			},
+			CallbackUrl: req.CallbackUrl,
+			Refund: Refund{
+				Address: req.RefundAddress,
+			},
+		}
+		if quote != nil {
+			payment.Quote = quote
+			payment.Quote.Expiration = payment.Expiration
 		}
 
-		// Prepare new entry
-		receiver, err := c.wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: payment.Id.String()})
-		if err != nil {
-			return fmt.Errorf("failed to prepare receiver address: %w", err)
+		// Reuse the receiver of a previous attempt, an expired receiver or prepare a new one
+		var receiver Receiver
+		found := *created != nil
+		if found {
+			receiver = **created
+		} else {
+			receiver, found, err = c.takeRecycled(ctx, txn)
+			if err != nil {
+				return fmt.Errorf("failed to take recycled receiver: %w", err)
+			}
 		}
+		if !found {
+			address, err := c.wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: payment.Id.String()})
+			if err != nil {
+				return fmt.Errorf("failed to prepare receiver address: %w", err)
+			}
+			receiver = Receiver{
+				Address: address.Address,
+				Index:   address.Index,
+			}
+			*created = &receiver
+		}
+		payment.Receiver = receiver
 
-		payment.Receiver = Receiver{
-			Address: receiver.Address,
-			Index:   receiver.Index,
+		// Owner of the receiver
+		err = txn.Set(ReceiverKey(payment.Receiver.Index), payment.Id[:])
+		if err != nil {
+			return fmt.Errorf("failed to set receiver owner: %w", err)
 		}
 
 		// Pending entry
@@ -87,10 +244,29 @@ func (c *Controller) Receive(ctx context.Context, req *Receive) (payment Payment
 			return fmt.Errorf("failed to set payment status: %w", err)
 		}
 
+		err = updateIndexes(txn, nil, &payment)
+		if err != nil {
+			return fmt.Errorf("failed to index payment: %w", err)
+		}
+
+		if req.OrderId != "" {
+			err = txn.Set(OrderKey(payment.Merchant, payment.OrderId, payment.Id), payment.Id[:])
+			if err != nil {
+				return fmt.Errorf("failed to index order: %w", err)
+			}
+		}
+
+		if req.IdempotencyKey != "" {
+			err = c.remember(txn, req, hash, &payment)
+			if err != nil {
+				return fmt.Errorf("failed to remember idempotency key: %w", err)
+			}
+		}
+
 		return nil
 	})
-	if err != nil {
-		return payment, fmt.Errorf("failed to add entry to the database: %w", err)
+	if err == nil && !replayed {
+		c.metrics.PaymentCreated()
 	}
-	return payment, nil
+	return payment, err
 }
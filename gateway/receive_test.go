@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Wallet running a hook after creating the first address
+type hookWallet struct {
+	wallets.Wallet
+	created int
+	hook    func()
+}
+
+func (w *hookWallet) NewAddress(ctx context.Context, req wallets.NewAddressRequest) (address wallets.Address, err error) {
+	address, err = w.Wallet.NewAddress(ctx, req)
+	w.created++
+	if w.created == 1 {
+		w.hook()
+	}
+	return address, err
+}
+
+func Test_Receive(t *testing.T) {
+	t.Parallel()
+
+	setup := func(t *testing.T) (c Controller, wallet *hookWallet) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		wallet = &hookWallet{Wallet: mock.New(mock.Config{})}
+		c = New(Config{
+			DB:                db,
+			Wallet:            wallet,
+			MaxAmount:         ^uint64(0),
+			RecycleQuarantine: time.Hour,
+		})
+		return c, wallet
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet := setup(t)
+		receive := Receive{
+			Address:        "mock_beneficiary",
+			Amount:         1_000_000,
+			Priority:       wallets.PriorityHigh,
+			IdempotencyKey: "order-1",
+		}
+
+		// Touches the idempotency key read by the attempt so it conflicts
+		var receiver wallets.Address
+		wallet.hook = func() {
+			receiver, _ = wallet.Wallet.Address(ctx, wallets.AddressRequest{Index: 1})
+			for _, update := range []func(txn *badger.Txn) error{
+				func(txn *badger.Txn) error { return txn.Set(IdempotencyKey(uuid.Nil, receive.IdempotencyKey), nil) },
+				func(txn *badger.Txn) error { return txn.Delete(IdempotencyKey(uuid.Nil, receive.IdempotencyKey)) },
+			} {
+				assertions.Nil(c.db.Update(update), "failed to touch idempotency key")
+			}
+		}
+
+		payment, err := c.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+		assertions.Equal(1, wallet.created, "retries should reuse the created receiver")
+		assertions.Equal(receiver.Address, payment.Receiver.Address, "payment should own the created receiver")
+	})
+	t.Run("Released", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		c, wallet := setup(t)
+		receive := Receive{
+			Address:        "mock_beneficiary",
+			Amount:         1_000_000,
+			Priority:       wallets.PriorityHigh,
+			IdempotencyKey: "order-1",
+		}
+
+		// A concurrent request with the same key wins the race
+		winner := Payment{Id: uuid.New(), Receiver: Receiver{Address: "mock_address_0", Index: 0}}
+		wallet.hook = func() {
+			err := c.db.Update(func(txn *badger.Txn) (err error) {
+				err = txn.Set(PaymentKey(winner.Id), winner.Bytes())
+				if err != nil {
+					return err
+				}
+				return c.remember(txn, &receive, receive.hash(), &winner)
+			})
+			assertions.Nil(err, "failed to store concurrent payment")
+		}
+
+		payment, err := c.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to replay payment")
+		assertions.Equal(winner.Id, payment.Id, "concurrent payment should be replayed")
+
+		receive.IdempotencyKey = ""
+		payment, err = c.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+		assertions.Equal(1, wallet.created, "unused receiver should be recycled")
+		assertions.EqualValues(1, payment.Receiver.Index, "payment should take the released receiver")
+	})
+}
@@ -0,0 +1,258 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+// Maximum number of recycled receivers inspected per Receive
+const maxRecycleCandidates = 16
+
+// Receiver waiting in the recycle pool
+type Recyclable struct {
+	// Receiver to reuse
+	Receiver Receiver
+	// Last payment that used the receiver. Nil for receivers released by a failed Receive
+	Payment uuid.UUID
+	// Transaction that emptied the receiver. Empty when nothing was received
+	Transaction string
+}
+
+func (r *Recyclable) Bytes() (bytes []byte) {
+	bytes, _ = json.Marshal(r)
+	return bytes
+}
+
+func (r *Recyclable) FromBytes(b []byte) (err error) {
+	return json.Unmarshal(b, r)
+}
+
+// Adds the receiver of the payment to the recycle pool. It becomes available after the quarantine
+// so late deposits can still be attributed to the payment
+func (c *Controller) recycle(p Payment, transaction string) (err error) {
+	if c.recycleQuarantine == 0 {
+		return nil
+	}
+
+	recyclable := Recyclable{
+		Receiver:    p.Receiver,
+		Payment:     p.Id,
+		Transaction: transaction,
+	}
+	return c.db.Update(func(txn *badger.Txn) (err error) {
+		key := RecycleKey(time.Now().Add(c.recycleQuarantine), p.Receiver.Index)
+		err = txn.Set(key, recyclable.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to add receiver to the recycle pool: %w", err)
+		}
+		return nil
+	})
+}
+
+// Adds a receiver created for a payment that was never stored to the recycle pool. It is
+// available right away since nobody knows it
+func (c *Controller) release(receiver Receiver) (err error) {
+	if c.recycleQuarantine == 0 {
+		return nil
+	}
+
+	recyclable := Recyclable{Receiver: receiver}
+	return c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(ReceiverKey(receiver.Index), recyclable.Payment[:])
+		if err != nil {
+			return fmt.Errorf("failed to set receiver owner: %w", err)
+		}
+		err = txn.Set(RecycleKey(time.Now(), receiver.Index), recyclable.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to add receiver to the recycle pool: %w", err)
+		}
+		return nil
+	})
+}
+
+// Verifies the receiver is empty and its last transaction confirmed
+// keep reports if the entry should remain in the pool for a later try
+func (c *Controller) reusable(ctx context.Context, txn *badger.Txn, r *Recyclable) (ok, keep bool, err error) {
+	// The receiver was recycled more than once and someone else already took it
+	item, err := txn.Get(ReceiverKey(r.Receiver.Index))
+	if err != nil {
+		return false, true, fmt.Errorf("failed to retrieve receiver owner: %w", err)
+	}
+	var owner uuid.UUID
+	err = item.Value(func(val []byte) (err error) {
+		owner, err = uuid.FromBytes(val)
+		return err
+	})
+	if err != nil {
+		return false, false, fmt.Errorf("failed to parse receiver owner: %w", err)
+	}
+	if owner != r.Payment {
+		return false, false, nil
+	}
+
+	address, err := c.wallet.Address(ctx, wallets.AddressRequest{Index: r.Receiver.Index})
+	if err != nil {
+		return false, true, fmt.Errorf("failed to retrieve address: %w", err)
+	}
+
+	if address.Address != r.Receiver.Address {
+		return false, false, errors.New("expecting a different address; did server wallet changed?")
+	}
+
+	// Funds arrived during the quarantine. They belong to the previous payment
+	if address.Balance > 0 {
+		return false, false, nil
+	}
+
+	if r.Transaction == "" {
+		return true, false, nil
+	}
+
+	tx, err := c.wallet.Transaction(ctx, wallets.TransactionRequest{SourceIndex: r.Receiver.Index, TransactionId: r.Transaction})
+	if err != nil {
+		return false, true, fmt.Errorf("failed to retrieve transaction: %w", err)
+	}
+
+	switch tx.Status {
+	case wallets.TransactionStatusCompleted:
+		return true, false, nil
+	case wallets.TransactionStatusPending:
+		return false, true, nil
+	default:
+		return false, false, nil
+	}
+}
+
+// Appends the transactions of the previous owner to the history of the receiver. Transfers
+// recovered for the new owner can't be any of them
+func recordHistory(txn *badger.Txn, r *Recyclable) (err error) {
+	// Released receivers never had an owner
+	if r.Payment == uuid.Nil {
+		return nil
+	}
+
+	var previous Payment
+	item, err := txn.Get(PaymentKey(r.Payment))
+	if err != nil {
+		return fmt.Errorf("failed to retrieve previous owner: %w", err)
+	}
+	err = item.Value(previous.FromBytes)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal previous owner: %w", err)
+	}
+
+	history, err := readHistory(txn, r.Receiver.Index)
+	if err != nil {
+		return err
+	}
+	history = append(history, previous.transactions()...)
+
+	contents, _ := json.Marshal(history)
+	err = txn.Set(HistoryKey(r.Receiver.Index), contents)
+	if err != nil {
+		return fmt.Errorf("failed to set receiver history: %w", err)
+	}
+	return nil
+}
+
+func readHistory(txn *badger.Txn, index uint64) (history []string, err error) {
+	item, err := txn.Get(HistoryKey(index))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get receiver history: %w", err)
+	}
+	err = item.Value(func(val []byte) (err error) {
+		return json.Unmarshal(val, &history)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal receiver history: %w", err)
+	}
+	return history, nil
+}
+
+// Transactions recorded by the previous owners of the receiver
+func (c *Controller) receiverHistory(index uint64) (history []string, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		history, err = readHistory(txn, index)
+		return err
+	})
+	return history, err
+}
+
+// Takes the first available receiver from the recycle pool
+func (c *Controller) takeRecycled(ctx context.Context, txn *badger.Txn) (receiver Receiver, found bool, err error) {
+	if c.recycleQuarantine == 0 {
+		return receiver, false, nil
+	}
+
+	type candidate struct {
+		key        []byte
+		recyclable Recyclable
+	}
+
+	limit := RecycleKey(time.Now(), ^uint64(0))
+
+	var candidates []candidate
+	func() {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = recyclePrefixBytes
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(recyclePrefixBytes) && len(candidates) < maxRecycleCandidates; it.Next() {
+			item := it.Item()
+			if bytes.Compare(item.Key(), limit) > 0 {
+				break
+			}
+
+			var entry = candidate{key: item.KeyCopy(nil)}
+			err := item.Value(entry.recyclable.FromBytes)
+			if err != nil {
+				c.logger.Error("failed to retrieve recyclable receiver", logging.KeyError, err)
+				continue
+			}
+			candidates = append(candidates, entry)
+		}
+	}()
+
+	for _, entry := range candidates {
+		ok, keep, err := c.reusable(ctx, txn, &entry.recyclable)
+		if err != nil {
+			c.logger.Error("failed to verify recyclable receiver", logging.KeyReceiver, entry.recyclable.Receiver.Index, logging.KeyError, err)
+		}
+		if keep {
+			continue
+		}
+
+		err = txn.Delete(entry.key)
+		if err != nil {
+			return receiver, false, fmt.Errorf("failed to remove receiver from the recycle pool: %w", err)
+		}
+
+		if ok {
+			// Deposits received from now on belong to the new owner
+			err = txn.Delete(FinalizedKey(entry.recyclable.Payment))
+			if err != nil {
+				return receiver, false, fmt.Errorf("failed to remove finalized entry of the previous owner: %w", err)
+			}
+
+			err = recordHistory(txn, &entry.recyclable)
+			if err != nil {
+				return receiver, false, fmt.Errorf("failed to record history of the previous owner: %w", err)
+			}
+			return entry.recyclable.Receiver, true, nil
+		}
+	}
+	return receiver, false, nil
+}
@@ -0,0 +1,226 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Payments returned to the payer instead of forwarded to the beneficiary
+type RefundPolicy struct {
+	// Expired payments that didn't receive the entire amount are returned completely
+	Underpaid bool
+	// Funds received above the amount of the payment are returned
+	Overpaid bool
+}
+
+// Reports if the payment should be entirely refunded
+func (c *Controller) refundUnderpaid(p *Payment, received uint64) (ok bool) {
+	return c.refund.Underpaid && p.Refund.Address != "" && received < p.Amount
+}
+
+// Returns the excess of the payment that should be refunded
+func (c *Controller) refundOverpaid(p *Payment, received uint64) (excess uint64) {
+	if !c.refund.Overpaid || p.Refund.Address == "" || received <= p.Amount {
+		return 0
+	}
+	return received - p.Amount
+}
+
+// Returns the excess of an overpaid payment while the fee remains in the receiver. The network
+// fee of the beneficiary transaction already came out of the excess, so the refund pays its own
+// network fee when the wallet supports it
+func (c *Controller) refundExcess(ctx context.Context, p *Payment, receiver wallets.Address) (transfer wallets.Transfer, err error) {
+	amount := min(p.Refund.Amount, receiver.UnlockedBalance)
+
+	multi, ok := c.wallet.(wallets.MultiTransferer)
+	if !ok {
+		return c.transfer(ctx, p, LegRefund, receiver, wallets.TransferRequest{
+			SourceIndex: p.Receiver.Index,
+			Destination: p.Refund.Address,
+			Amount:      amount,
+			Priority:    p.Priority,
+			UnlockTime:  0,
+		})
+	}
+
+	many, err := c.transferMany(ctx, p, LegRefund, receiver, multi, wallets.TransferManyRequest{
+		SourceIndex:     p.Receiver.Index,
+		Destinations:    []wallets.Destination{{Address: p.Refund.Address, Amount: amount}},
+		SubtractFeeFrom: 0,
+		Priority:        p.Priority,
+		UnlockTime:      0,
+	})
+	if err != nil {
+		return transfer, err
+	}
+	transfer = wallets.Transfer{
+		Address:     many.Address,
+		SourceIndex: many.SourceIndex,
+		Destination: many.Destinations[0].Address,
+		Amount:      many.Destinations[0].Amount,
+		Fee:         many.Fee,
+	}
+	return transfer, nil
+}
+
+func (c *Controller) processRefund(ctx context.Context, p Payment, balances balances) (err error) {
+	// Waiting for the next attempt after a wallet error
+	if !p.Refund.Retry.ready(time.Now()) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultTimeout)
+	defer cancel()
+
+	address, err := c.receiverState(ctx, &p, LegRefund, balances)
+	if err != nil {
+		return fmt.Errorf("failed to get address: %w", err)
+	}
+
+	if address.Balance == 0 {
+		return nil
+	}
+
+	// We can wait for the rest of the money to arrive
+	if address.Balance > address.UnlockedBalance {
+		return nil
+	}
+
+	// Nothing else is owed from the receiver so the payer gets whatever the beneficiary
+	// transaction left
+	if p.Beneficiary.Status == StatusRefunded || p.Fee.Percentage == 0 {
+		sweep, err := c.sweep(ctx, &p, LegRefund, address, wallets.SweepRequest{
+			SourceIndex: p.Receiver.Index,
+			Destination: p.Refund.Address,
+			Priority:    p.Priority,
+			UnlockTime:  0,
+		})
+		if errors.Is(err, ErrAwaitingSignature) {
+			return c.awaitSignature(&p, &p.Refund.Status)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to transfer funds: %w", err)
+			p.Refund.SetError(err)
+			if !c.registerAttempt(&p.Refund.Retry, err) {
+				p.Refund.Status = StatusFailed
+				return c.fail(&p, LegRefund, RefundKey(p.Id), err)
+			}
+
+			err = c.savePaymentState(p)
+			if err != nil {
+				return fmt.Errorf("failed to set save payment: %w", err)
+			}
+			return err
+		}
+
+		p.Refund.Payed = sweep.Amount
+		p.Refund.Transaction = sweep.Address
+	} else {
+		transfer, err := c.refundExcess(ctx, &p, address)
+		if errors.Is(err, ErrAwaitingSignature) {
+			return c.awaitSignature(&p, &p.Refund.Status)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to transfer funds: %w", err)
+			p.Refund.SetError(err)
+			if !c.registerAttempt(&p.Refund.Retry, err) {
+				p.Refund.Status = StatusFailed
+				return c.fail(&p, LegRefund, RefundKey(p.Id), err)
+			}
+
+			err = c.savePaymentState(p)
+			if err != nil {
+				return fmt.Errorf("failed to set save payment: %w", err)
+			}
+			return err
+		}
+
+		p.Refund.Payed = transfer.Amount
+		p.Refund.Transaction = transfer.Address
+	}
+	p.Refund.Status = StatusCompleted
+	p.Refund.Error = ""
+
+	err = c.savePaymentState(p)
+	if err != nil {
+		return fmt.Errorf("failed to set save payment: %w", err)
+	}
+	err = c.deleteKey(RefundKey(p.Id))
+	if err != nil {
+		return fmt.Errorf("failed to delete pending refund entry: %w", err)
+	}
+
+	// The fee is collected once the payer has its funds back
+	if p.Fee.Status == StatusPending {
+		err = c.savePendingFee(p)
+		if err != nil {
+			return fmt.Errorf("failed to save pending fee: %w", err)
+		}
+		return nil
+	}
+
+	err = c.finalize(p)
+	if err != nil {
+		return fmt.Errorf("failed to finalize payment: %w", err)
+	}
+
+	err = c.recycle(p, p.Refund.Transaction)
+	if err != nil {
+		return fmt.Errorf("failed to recycle receiver: %w", err)
+	}
+	return nil
+}
+
+// ProcessPendingRefunds goes over all payments with funds to return to the payer
+func (c *Controller) ProcessPendingRefunds(iteration context.Context) (processed uint64, err error) {
+	defer func(start time.Time) { c.metrics.Loop("refunds", start, processed) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(iteration, utils.DefaultTimeout)
+	defer cancel()
+
+	err = c.sync(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	payments, err := c.listPayments(refundPrefixBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+
+	balances, err := c.receiverBalances(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs = utils.NewJobPool(MaxConcurrentJobs)
+	var wg sync.WaitGroup
+	for _, payment := range payments {
+		// Canceled iterations stop dispatching payments
+		if iteration.Err() != nil {
+			break
+		}
+		processed++
+		jobs.Get()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jobs.Put()
+
+			err := c.processRefund(iteration, payment, balances)
+			if err != nil {
+				c.paymentLogger(&payment, LegRefund).Error("failed to process refund", logging.KeyError, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return processed, nil
+}
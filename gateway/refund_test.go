@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Wallet whose transfers always fail
+type failingWallet struct {
+	wallets.Wallet
+}
+
+func (w *failingWallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	return transfer, errors.New("wallet unavailable")
+}
+
+func (w *failingWallet) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep wallets.Sweep, err error) {
+	return sweep, errors.New("wallet unavailable")
+}
+
+func Test_ProcessRefund(t *testing.T) {
+	t.Parallel()
+	assertions := assert.New(t)
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if !assertions.Nil(err, "failed to open database") {
+		return
+	}
+	defer db.Close()
+
+	c := New(Config{
+		DB:        db,
+		Wallet:    &failingWallet{Wallet: mock.New(mock.Config{})},
+		MaxAmount: ^uint64(0),
+		Retry: RetryConfig{
+			MaxAttempts: 2,
+			Backoff:     time.Millisecond,
+		},
+	})
+
+	// The funded address 0 of the mock plays the receiver
+	p := Payment{
+		Id:          uuid.New(),
+		Receiver:    Receiver{Address: "mock_address_0", Index: 0},
+		Beneficiary: Beneficiary{Status: StatusCompleted},
+		Refund: Refund{
+			Status:  StatusPending,
+			Address: "mock_payer",
+			Amount:  1_000_000,
+		},
+	}
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(PaymentKey(p.Id), p.Bytes())
+		if err != nil {
+			return err
+		}
+		return txn.Set(RefundKey(p.Id), p.Id[:])
+	})
+	if !assertions.Nil(err, "failed to store payment") {
+		return
+	}
+
+	err = c.processRefund(context.TODO(), p, nil)
+	assertions.Nil(err, "failed attempts should be saved")
+
+	p, err = c.Query(context.TODO(), p.Id)
+	assertions.Nil(err, "failed to query payment")
+	assertions.Equal(StatusError, p.Refund.Status, "failed attempts should be retried")
+	assertions.EqualValues(1, p.Refund.Attempts, "attempt should be registered")
+
+	// Nothing is attempted before the backoff
+	err = c.processRefund(context.TODO(), p, nil)
+	assertions.Nil(err, "refund shouldn't be attempted during the backoff")
+
+	time.Sleep(10 * time.Millisecond)
+	err = c.processRefund(context.TODO(), p, nil)
+	assertions.Nil(err, "exhausted refunds should be failed")
+
+	p, err = c.Query(context.TODO(), p.Id)
+	assertions.Nil(err, "failed to query payment")
+	assertions.Equal(StatusFailed, p.Refund.Status, "exhausted refunds should be failed")
+
+	payments, err := c.listPayments(refundPrefixBytes)
+	assertions.Nil(err, "failed to list refunds")
+	assertions.Empty(payments, "failed refunds should leave the queue")
+}
+
+func Test_RefundOverpaid(t *testing.T) {
+	t.Parallel()
+
+	type Test struct {
+		Name       string
+		Percentage uint64
+	}
+	tests := []Test{
+		{Name: "NoFee", Percentage: 0},
+		{Name: "Fee", Percentage: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			t.Parallel()
+			assertions := assert.New(t)
+
+			ctx, cancel := utils.NewContext()
+			defer cancel()
+
+			db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+			if !assertions.Nil(err, "failed to open database") {
+				return
+			}
+			defer db.Close()
+
+			wallet := mock.New(mock.Config{})
+			c := New(Config{
+				DB:            db,
+				Wallet:        wallet,
+				MaxAmount:     ^uint64(0),
+				Address:       "mock_gateway",
+				FeePercentage: test.Percentage,
+				Refund:        RefundPolicy{Overpaid: true},
+			})
+
+			p, err := c.Receive(ctx, &Receive{
+				Address:       "mock_beneficiary",
+				Amount:        1_000_000,
+				Priority:      wallets.PriorityHigh,
+				RefundAddress: "mock_payer",
+			})
+			if !assertions.Nil(err, "failed to create payment") {
+				return
+			}
+			_, err = wallet.Transfer(ctx, wallets.TransferRequest{SourceIndex: 0, Destination: p.Receiver.Address, Amount: 1_500_000})
+			assertions.Nil(err, "failed to transfer to receiver")
+
+			_, err = c.ProcessPendingPayments(context.TODO())
+			assertions.Nil(err, "failed to process payments")
+			_, err = c.ProcessPendingRefunds(context.TODO())
+			assertions.Nil(err, "failed to process refunds")
+
+			p, err = c.Query(ctx, p.Id)
+			assertions.Nil(err, "failed to query payment")
+			assertions.Equal(StatusCompleted, p.Beneficiary.Status, "beneficiary should be payed")
+			assertions.Equal(StatusCompleted, p.Refund.Status, "excess should be refunded: %s", p.Refund.Error)
+			assertions.NotZero(p.Refund.Payed, "nothing refunded")
+			assertions.LessOrEqual(p.Refund.Payed, p.Refund.Amount, "refund can't exceed the excess")
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+const (
+	DefaultRetryMaxAttempts = 10
+	DefaultRetryBackoff     = 30 * time.Second
+	DefaultRetryMaxBackoff  = time.Hour
+)
+
+type RetryConfig struct {
+	// Maximum number of failed attempts before the leg is failed
+	MaxAttempts uint64
+	// Delay after the first failed attempt. Doubled on every retry
+	Backoff time.Duration
+	// Maximum delay between attempts
+	MaxBackoff time.Duration
+	// Called when a leg of the payment reaches the failed status, after logging it
+	Alert func(p *Payment, err error)
+}
+
+func (r *RetryConfig) setDefaults() {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if r.Backoff == 0 {
+		r.Backoff = DefaultRetryBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = DefaultRetryMaxBackoff
+	}
+}
+
+// Failed attempts of a leg of the payment
+type Retry struct {
+	// Number of failed attempts
+	Attempts uint64
+	// The leg is not retried before this moment
+	NextAttempt time.Time
+}
+
+// Reports if the leg can be attempted
+func (r *Retry) ready(now time.Time) (ok bool) {
+	return !now.Before(r.NextAttempt)
+}
+
+// Saves the failed leg, removes it from its queue and alerts the operator
+func (c *Controller) fail(p *Payment, leg string, key []byte, cause error) (err error) {
+	err = c.savePaymentState(*p)
+	if err != nil {
+		return fmt.Errorf("failed to set save payment: %w", err)
+	}
+	err = c.deleteKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete queue entry: %w", err)
+	}
+
+	c.paymentLogger(p, leg).Error("payment leg failed", logging.KeyError, cause)
+	if c.retry.Alert != nil {
+		c.retry.Alert(p, cause)
+	}
+	return nil
+}
+
+// Registers a failed attempt. Reports false when the leg should not be retried anymore
+func (c *Controller) registerAttempt(r *Retry, err error) (retry bool) {
+	r.Attempts++
+	if errors.Is(err, wallets.ErrPermanent) || r.Attempts >= c.retry.MaxAttempts {
+		return false
+	}
+	r.NextAttempt = time.Now().Add(utils.Backoff(c.retry.Backoff, c.retry.MaxBackoff, r.Attempts))
+	return true
+}
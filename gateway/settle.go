@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Pays the beneficiary and the fee in a single transaction. The network fee is discounted from the fee
+// so the beneficiary receives exactly its share. settled is false when the payment should be processed
+// in two steps
+func (c *Controller) settle(ctx context.Context, p *Payment, receiver wallets.Address, received uint64) (settled bool, err error) {
+	if !c.singleTransaction {
+		return false, nil
+	}
+
+	multi, ok := c.wallet.(wallets.MultiTransferer)
+	if !ok {
+		return false, nil
+	}
+
+	fee := calculateFee(received, p.Fee.Percentage)
+	if fee == 0 {
+		return false, nil
+	}
+
+	transfer, err := c.transferMany(ctx, p, LegBeneficiary, receiver, multi, wallets.TransferManyRequest{
+		SourceIndex: p.Receiver.Index,
+		Destinations: []wallets.Destination{
+			{Address: p.Beneficiary.Address, Amount: received - fee},
+			{Address: p.Fee.Address, Amount: fee},
+		},
+		SubtractFeeFrom: 1,
+		Priority:        p.Priority,
+		UnlockTime:      0,
+	})
+	if err != nil {
+		// The fee can't pay the network. The fee leg sweeps whatever remains
+		if errors.Is(err, wallets.ErrFeeExceedsAmount) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to transfer to multiple destinations: %w", err)
+	}
+
+	p.Beneficiary.Payed = transfer.Destinations[0].Amount
+	p.Beneficiary.Transaction = transfer.Address
+	p.Fee.Payed = transfer.Destinations[1].Amount
+	p.Fee.Transaction = transfer.Address
+	p.Fee.Status = StatusCompleted
+	return true, nil
+}
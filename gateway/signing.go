@@ -0,0 +1,194 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+var (
+	// The transfer of the leg was prepared and waits to be signed offline
+	ErrAwaitingSignature    = errors.New("transfer awaiting signature")
+	ErrNotAwaitingSignature = errors.New("transfer isn't awaiting a signature")
+	ErrViewOnlyUnsupported  = fmt.Errorf("%w: wallet doesn't support view-only mode", wallets.ErrPermanent)
+)
+
+// Transfer of a leg waiting for the offline signature
+type UnsignedTransfer struct {
+	// Payment moving the funds
+	Payment uuid.UUID
+	// Leg of the payment moving the funds
+	Leg string
+	// Transfer prepared by the view-only wallet
+	Transfer wallets.UnsignedTransfer
+	// Moment the transfer was prepared
+	Created time.Time
+}
+
+// Everything the offline wallet needs to sign the queued transfers
+type SigningBatch struct {
+	// Outputs of the view-only wallet. Imported by the offline wallet before signing
+	Outputs string
+	// Transfers waiting for the signature
+	Transfers []UnsignedTransfer
+}
+
+type SignedTransfer struct {
+	// Payment moving the funds
+	Payment uuid.UUID
+	// Leg of the payment moving the funds
+	Leg string
+	// Transaction set signed by the offline wallet
+	Txset string
+}
+
+// Result of signing a SigningBatch
+type SignedBatch struct {
+	// Key images of the offline wallet. Imported so the view-only wallet knows the spent outputs
+	KeyImages []wallets.KeyImage
+	// Transfers ready to be submitted
+	Transfers []SignedTransfer
+}
+
+func (c *Controller) signer() (signer wallets.ViewOnly, err error) {
+	signer, ok := c.wallet.(wallets.ViewOnly)
+	if !ok {
+		return nil, ErrViewOnlyUnsupported
+	}
+	return signer, nil
+}
+
+// Prepares the unsigned transfer of the intent
+func (c *Controller) prepare(p *Payment, intent *Intent, prepare func(signer wallets.ViewOnly) (unsigned wallets.UnsignedTransfer, err error)) (err error) {
+	signer, err := c.signer()
+	if err != nil {
+		return err
+	}
+
+	unsigned, err := prepare(signer)
+	if err != nil {
+		return err
+	}
+
+	intent.Unsigned = &unsigned
+	err = c.saveIntent(intent)
+	if err != nil {
+		return fmt.Errorf("failed to save unsigned transfer: %w", err)
+	}
+
+	c.paymentLogger(p, intent.Leg).Info("transfer awaiting signature")
+	return ErrAwaitingSignature
+}
+
+// Moves the leg to the awaiting-signature status
+func (c *Controller) awaitSignature(p *Payment, status *Status) (err error) {
+	if *status == StatusAwaitingSignature {
+		return nil
+	}
+
+	*status = StatusAwaitingSignature
+	err = c.savePaymentState(*p)
+	if err != nil {
+		return fmt.Errorf("failed to set save payment: %w", err)
+	}
+	return nil
+}
+
+// Signing returns the transfers waiting for the offline signature with the outputs needed to sign them
+func (c *Controller) Signing(ctx context.Context) (batch SigningBatch, err error) {
+	signer, err := c.signer()
+	if err != nil {
+		return batch, err
+	}
+
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = intentPrefixBytes
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(intentPrefixBytes); it.Next() {
+			var intent Intent
+			err = it.Item().Value(intent.FromBytes)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal intent: %w", err)
+			}
+			if intent.Unsigned == nil || intent.Transfer != nil {
+				continue
+			}
+
+			batch.Transfers = append(batch.Transfers, UnsignedTransfer{
+				Payment:  intent.Payment,
+				Leg:      intent.Leg,
+				Transfer: *intent.Unsigned,
+				Created:  intent.Created,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return batch, fmt.Errorf("failed to retrieve unsigned transfers: %w", err)
+	}
+
+	batch.Outputs, err = signer.ExportOutputs(ctx)
+	if err != nil {
+		return batch, fmt.Errorf("failed to export outputs: %w", err)
+	}
+	return batch, nil
+}
+
+// Submit imports the key images of the offline wallet and relays the signed transfers. The legs
+// complete on their next processing. Transfers already submitted are skipped
+func (c *Controller) Submit(ctx context.Context, batch SignedBatch) (submitted uint64, err error) {
+	signer, err := c.signer()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(batch.KeyImages) > 0 {
+		err = signer.ImportKeyImages(ctx, wallets.ImportKeyImagesRequest{KeyImages: batch.KeyImages})
+		if err != nil {
+			return 0, fmt.Errorf("failed to import key images: %w", err)
+		}
+	}
+
+	for _, signed := range batch.Transfers {
+		intent, found, err := c.intent(signed.Payment, signed.Leg)
+		if err != nil {
+			return submitted, fmt.Errorf("failed to retrieve intent: %w", err)
+		}
+		if !found || intent.Unsigned == nil {
+			return submitted, fmt.Errorf("%w: payment %v leg %s", ErrNotAwaitingSignature, signed.Payment, signed.Leg)
+		}
+		if intent.Transfer != nil {
+			continue
+		}
+
+		transactionIds, err := signer.Submit(ctx, wallets.SubmitRequest{Txset: signed.Txset})
+		if err != nil {
+			return submitted, fmt.Errorf("failed to submit transfer of payment %v: %w", signed.Payment, err)
+		}
+		if len(transactionIds) != 1 {
+			return submitted, fmt.Errorf("expecting a single transaction for payment %v but got %d", signed.Payment, len(transactionIds))
+		}
+
+		intent.Transfer = &wallets.TransferMany{
+			Address:      transactionIds[0],
+			SourceIndex:  intent.Unsigned.SourceIndex,
+			Destinations: intent.Unsigned.Destinations,
+			Fee:          intent.Unsigned.Fee,
+		}
+		err = c.saveIntent(&intent)
+		if err != nil {
+			// The next processing finds the transfer in the wallet history
+			return submitted, fmt.Errorf("failed to save submitted transfer: %w", err)
+		}
+		submitted++
+	}
+	return submitted, nil
+}
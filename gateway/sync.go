@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Coalesces the wallet syncs of the processing loops running at the same time
+type syncer struct {
+	mutex  sync.Mutex
+	synced time.Time
+}
+
+// Syncs the wallet incrementally unless other loop already synced it after the call started.
+// Processing loops sync once and then only read the balances of their receivers
+func (c *Controller) sync(ctx context.Context) (err error) {
+	start := time.Now()
+
+	c.syncer.mutex.Lock()
+	defer c.syncer.mutex.Unlock()
+
+	if c.syncer.synced.After(start) {
+		return nil
+	}
+
+	err = c.wallet.Sync(ctx, false)
+	if err != nil {
+		return fmt.Errorf("failed to sync wallet: %w", err)
+	}
+	c.syncer.synced = time.Now()
+	return nil
+}
@@ -2,17 +2,31 @@ package testsuite
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	_ "embed"
 
+	"github.com/RogueTeam/8ball/decimal"
 	"github.com/RogueTeam/8ball/gateway"
+	"github.com/RogueTeam/8ball/oracles"
+	"github.com/RogueTeam/8ball/oracles/static"
 	"github.com/RogueTeam/8ball/random"
 	"github.com/RogueTeam/8ball/utils"
 	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/monero"
 	"github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
@@ -23,11 +37,932 @@ type DataGenerator interface {
 	TransferAmount() (funds uint64)
 }
 
+// Wallet failing every outgoing transfer
+type failingWallet struct {
+	wallets.Wallet
+	err error
+}
+
+func (w *failingWallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	return transfer, w.err
+}
+
+func (w *failingWallet) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep wallets.Sweep, err error) {
+	return sweep, w.err
+}
+
+// Wallet losing the response of its first transfer after making it
+type crashingWallet struct {
+	wallets.Wallet
+	crashed atomic.Bool
+}
+
+func (w *crashingWallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	transfer, err = w.Wallet.Transfer(ctx, req)
+	if err == nil && w.crashed.CompareAndSwap(false, true) {
+		return wallets.Transfer{}, errors.New("connection reset by peer")
+	}
+	return transfer, err
+}
+
+// Wallet simulating the offline signature of the transfers prepared in view-only mode
+type offlineSigner interface {
+	Sign(txset string) (signed string, err error)
+}
+
+// Creates a controller over an in-memory database closed with the test. The gateway address
+// defaults to the new business address and the maximum amount to no limit
+func newController(t *testing.T, config gateway.Config) (ctrl gateway.Controller, business wallets.Address) {
+	t.Helper()
+
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	label := random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)
+	business, err := config.Wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: label})
+	if err != nil {
+		t.Fatalf("failed to create business address: %v", err)
+	}
+
+	config.DB, err = badger.Open(badger.DefaultOptions("").WithInMemory(true))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { config.DB.Close() })
+
+	if config.Address == "" {
+		config.Address = business.Address
+	}
+	if config.MaxAmount == 0 {
+		config.MaxAmount = ^uint64(0)
+	}
+	return gateway.New(config), business
+}
+
+// Creates a payment of amount to the business address
+func newPayment(t *testing.T, ctrl *gateway.Controller, business wallets.Address, amount uint64) (payment gateway.Payment) {
+	t.Helper()
+
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	payment, err := ctrl.Receive(ctx, &gateway.Receive{
+		Address:  business.Address,
+		Amount:   amount,
+		Priority: wallets.PriorityHigh,
+	})
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+	return payment
+}
+
+// Transfers amount from the account 0 of the wallet to the receiver. Safe to call outside the
+// goroutine of the test
+func fund(t *testing.T, wallet wallets.Wallet, receiver string, amount uint64) (transfer wallets.Transfer) {
+	t.Helper()
+
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	transfer, err := wallet.Transfer(ctx, wallets.TransferRequest{
+		SourceIndex: 0,
+		Destination: receiver,
+		Amount:      amount,
+		Priority:    wallets.PriorityHigh,
+		UnlockTime:  0,
+	})
+	assert.Nil(t, err, "failed to transfer to receiver")
+	return transfer
+}
+
 //go:embed tests/succeed.yaml
 var succeedTests []byte
 
 // Test runs a comprehensive suite of tests for any Wallet implementation.
 func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen DataGenerator) {
+	t.Run("Recycle", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Wallet:            wallet,
+			RecycleQuarantine: time.Nanosecond,
+		})
+
+		var receive = gateway.Receive{
+			Address:  business.Address,
+			Amount:   gen.TransferAmount(),
+			Priority: wallets.PriorityHigh,
+		}
+		expired, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+
+		_, err = ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+
+		expired, err = ctrl.Query(ctx, expired.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusExpired, expired.Beneficiary.Status, "payment should be expired")
+
+		recycled, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create second payment")
+		assertions.Equal(expired.Receiver, recycled.Receiver, "receiver should be recycled")
+
+		fresh, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create third payment")
+		assertions.NotEqual(recycled.Receiver, fresh.Receiver, "receiver should not be reused twice")
+	})
+	t.Run("Events", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Wallet: wallet,
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		events, unsubscribe := ctrl.Subscribe(payment.Id)
+		defer unsubscribe()
+
+		_, err := ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+
+		select {
+		case event := <-events:
+			assertions.Equal(payment.Id, event.Id, "invalid payment id")
+			assertions.Equal(gateway.StatusExpired, event.Beneficiary.Status, "expiration should be published")
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	})
+	t.Run("Watch", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		if _, ok := wallet.(wallets.Notifier); !ok {
+			t.Skip("wallet doesn't support notifications")
+		}
+
+		ctx, cancel := utils.NewContextWithTimeout(timeoutExtra + time.Minute)
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		events, unsubscribe := ctrl.Subscribe(payment.Id)
+		defer unsubscribe()
+
+		watchCtx, stop := context.WithCancel(ctx)
+		watching := make(chan error, 1)
+		go func() { watching <- ctrl.Watch(watchCtx) }()
+		defer func() {
+			stop()
+			assertions.Nil(<-watching, "failed to watch wallet")
+		}()
+
+		// Waiting for the subscription to the wallet
+		time.Sleep(time.Second)
+
+		fund(t, wallet, payment.Receiver.Address, payment.Amount)
+
+		// The payments loop never runs. Only the wallet events move the payment
+		select {
+		case event := <-events:
+			assertions.Equal(payment.Id, event.Id, "invalid payment id")
+			assertions.NotEqual(gateway.StatusPending, event.Beneficiary.Status, "received funds should be processed")
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		}
+	})
+
+	t.Run("Merchant", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout:       timeoutExtra + 30*time.Minute,
+			FeePercentage: 10,
+			Wallet:        wallet,
+		})
+
+		var feePercentage uint64 = 5
+		merchant, apiKey, err := ctrl.NewMerchant(ctx, gateway.Merchant{
+			Name:          "shop",
+			FeePercentage: &feePercentage,
+			Timeout:       time.Hour,
+			Address:       business.Address,
+		})
+		assertions.Nil(err, "failed to create merchant")
+
+		other, _, err := ctrl.NewMerchant(ctx, gateway.Merchant{Name: "other"})
+		assertions.Nil(err, "failed to create other merchant")
+
+		authenticated, err := ctrl.Authenticate(ctx, apiKey)
+		assertions.Nil(err, "failed to authenticate")
+		assertions.Equal(merchant.Id, authenticated.Id, "invalid merchant")
+
+		_, err = ctrl.Authenticate(ctx, "invalid")
+		assertions.ErrorIs(err, gateway.ErrInvalidApiKey, "invalid keys should be rejected")
+
+		payment, err := ctrl.Receive(ctx, &gateway.Receive{
+			Amount:   gen.TransferAmount(),
+			Priority: wallets.PriorityHigh,
+			Merchant: merchant.Id,
+		})
+		assertions.Nil(err, "failed to create payment")
+		assertions.Equal(merchant.Id, payment.Merchant, "payment should be tagged with the merchant")
+		assertions.Equal(business.Address, payment.Beneficiary.Address, "merchant address should be the default beneficiary")
+		assertions.EqualValues(5, payment.Fee.Percentage, "merchant fee should be used")
+		assertions.WithinDuration(time.Now().Add(time.Hour), payment.Expiration, time.Minute, "merchant timeout should be used")
+
+		_, err = ctrl.QueryMerchant(ctx, merchant.Id, payment.Id)
+		assertions.Nil(err, "merchant should query its own payments")
+
+		_, err = ctrl.QueryMerchant(ctx, other.Id, payment.Id)
+		assertions.ErrorIs(err, gateway.ErrPaymentNotFound, "merchants should not query other payments")
+	})
+	t.Run("Idempotency", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout:           timeoutExtra + 30*time.Minute,
+			Wallet:            wallet,
+			IdempotencyWindow: time.Second,
+		})
+
+		var receive = gateway.Receive{
+			Address:        business.Address,
+			Amount:         gen.TransferAmount(),
+			Priority:       wallets.PriorityHigh,
+			IdempotencyKey: "order-1",
+		}
+		first, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+
+		repeated, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to repeat payment")
+		assertions.Equal(first.Id, repeated.Id, "repeated requests should return the original payment")
+		assertions.Equal(first.Receiver, repeated.Receiver, "repeated requests should not create receivers")
+
+		mismatch := receive
+		mismatch.Amount++
+		_, err = ctrl.Receive(ctx, &mismatch)
+		assertions.ErrorIs(err, gateway.ErrIdempotencyMismatch, "different requests with the same key should be rejected")
+
+		time.Sleep(2 * time.Second)
+
+		expired, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment after the window")
+		assertions.NotEqual(first.Id, expired.Id, "keys should be forgotten after the window")
+	})
+	t.Run("Order", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+		})
+
+		var receive = gateway.Receive{
+			Address:  business.Address,
+			Amount:   gen.TransferAmount(),
+			Priority: wallets.PriorityHigh,
+			OrderId:  "order-1",
+			Metadata: map[string]string{"customer": "42"},
+		}
+		first, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+		assertions.Equal(receive.Metadata, first.Metadata, "metadata should be stored")
+
+		second, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create second payment")
+
+		nested := receive
+		nested.OrderId = "order-1/nested"
+		_, err = ctrl.Receive(ctx, &nested)
+		assertions.Nil(err, "failed to create nested payment")
+
+		payments, err := ctrl.FindByOrder(ctx, uuid.Nil, receive.OrderId)
+		assertions.Nil(err, "failed to find payments of order")
+		if assertions.Len(payments, 2, "only the payments of the order should be found") {
+			assertions.Equal(first.Id, payments[0].Id, "invalid first payment")
+			assertions.Equal(second.Id, payments[1].Id, "invalid second payment")
+		}
+
+		oversized := receive
+		oversized.Metadata = map[string]string{}
+		for i := range gateway.MaxMetadataEntries + 1 {
+			oversized.Metadata[strconv.Itoa(i)] = "value"
+		}
+		_, err = ctrl.Receive(ctx, &oversized)
+		assertions.NotNil(err, "oversized metadata should be rejected")
+	})
+	t.Run("Admin", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+		})
+
+		var receive = gateway.Receive{
+			Address:  business.Address,
+			Amount:   gen.TransferAmount(),
+			Priority: wallets.PriorityHigh,
+		}
+		canceled, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create payment")
+		pending, err := ctrl.Receive(ctx, &receive)
+		assertions.Nil(err, "failed to create second payment")
+
+		canceled, err = ctrl.Cancel(ctx, canceled.Id)
+		assertions.Nil(err, "failed to cancel payment")
+		assertions.Equal(gateway.StatusCanceled, canceled.Beneficiary.Status, "payment should be canceled")
+
+		_, err = ctrl.Cancel(ctx, canceled.Id)
+		assertions.ErrorIs(err, gateway.ErrNotCancelable, "payment should be canceled once")
+
+		_, err = ctrl.Retry(ctx, pending.Id)
+		assertions.ErrorIs(err, gateway.ErrNothingToRetry, "pending payments have nothing to retry")
+
+		all, err := ctrl.List(ctx, gateway.ListRequest{})
+		assertions.Nil(err, "failed to list payments")
+		if assertions.Len(all.Payments, 2, "invalid number of payments") {
+			assertions.Equal(canceled.Id, all.Payments[0].Id, "payments should be sorted by creation")
+		}
+
+		byStatus, err := ctrl.List(ctx, gateway.ListRequest{Status: gateway.StatusCanceled})
+		assertions.Nil(err, "failed to list payments by status")
+		if assertions.Len(byStatus.Payments, 1, "invalid number of canceled payments") {
+			assertions.Equal(canceled.Id, byStatus.Payments[0].Id, "invalid canceled payment")
+		}
+
+		future, err := ctrl.List(ctx, gateway.ListRequest{From: time.Now().Add(time.Hour)})
+		assertions.Nil(err, "failed to list payments by time")
+		assertions.Empty(future.Payments, "no payment was created in the future")
+
+		balances, err := ctrl.Balances(ctx)
+		assertions.Nil(err, "failed to retrieve balances")
+		assertions.Len(balances, 2, "every receiver should be reported")
+	})
+	t.Run("List", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+		})
+
+		label := random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)
+		otherAddress, err := wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: label})
+		assertions.Nil(err, "failed to create other address")
+
+		var created []gateway.Payment
+		for i := range 5 {
+			payment, err := ctrl.Receive(ctx, &gateway.Receive{
+				Address:  business.Address,
+				Amount:   gen.TransferAmount() + uint64(i),
+				Priority: wallets.PriorityHigh,
+			})
+			assertions.Nil(err, "failed to create payment")
+			created = append(created, payment)
+		}
+		other, err := ctrl.Receive(ctx, &gateway.Receive{
+			Address:  otherAddress.Address,
+			Amount:   gen.TransferAmount(),
+			Priority: wallets.PriorityHigh,
+		})
+		assertions.Nil(err, "failed to create other payment")
+
+		_, err = ctrl.Cancel(ctx, created[1].Id)
+		assertions.Nil(err, "failed to cancel payment")
+
+		// Pages
+		var listed []gateway.Payment
+		var req = gateway.ListRequest{Address: business.Address, Limit: 2}
+		for range 10 {
+			res, err := ctrl.List(ctx, req)
+			assertions.Nil(err, "failed to list payments")
+			listed = append(listed, res.Payments...)
+			if res.Next == "" {
+				break
+			}
+			req.Cursor = res.Next
+		}
+		if assertions.Len(listed, len(created), "every payment of the address should be listed") {
+			for i := range created {
+				assertions.Equal(created[i].Id, listed[i].Id, "payments should be listed by creation")
+			}
+		}
+
+		// Filters
+		canceled, err := ctrl.List(ctx, gateway.ListRequest{BeneficiaryStatus: gateway.StatusCanceled})
+		assertions.Nil(err, "failed to list by status")
+		if assertions.Len(canceled.Payments, 1, "status index should be updated") {
+			assertions.Equal(created[1].Id, canceled.Payments[0].Id, "invalid canceled payment")
+		}
+
+		pending, err := ctrl.List(ctx, gateway.ListRequest{BeneficiaryStatus: gateway.StatusPending})
+		assertions.Nil(err, "failed to list pending")
+		assertions.Len(pending.Payments, len(created), "previous status should be removed from the index")
+
+		byAmount, err := ctrl.List(ctx, gateway.ListRequest{
+			Address:   business.Address,
+			MinAmount: gen.TransferAmount() + 3,
+		})
+		assertions.Nil(err, "failed to list by amount")
+		assertions.Len(byAmount.Payments, 2, "invalid payments in amount range")
+
+		byAddress, err := ctrl.List(ctx, gateway.ListRequest{Address: otherAddress.Address})
+		assertions.Nil(err, "failed to list by address")
+		if assertions.Len(byAddress.Payments, 1, "invalid payments of address") {
+			assertions.Equal(other.Id, byAddress.Payments[0].Id, "invalid payment of address")
+		}
+
+		expiring, err := ctrl.List(ctx, gateway.ListRequest{ExpirationTo: time.Now()})
+		assertions.Nil(err, "failed to list by expiration")
+		assertions.Empty(expiring.Payments, "no payment expired yet")
+
+		indexed, err := ctrl.Reindex()
+		assertions.Nil(err, "failed to reindex")
+		assertions.EqualValues(len(created)+1, indexed, "every payment should be indexed")
+	})
+	t.Run("Retry", func(t *testing.T) {
+		t.Parallel()
+
+		type Test struct {
+			Name     string
+			Err      error
+			Attempts uint64
+		}
+		tests := []Test{
+			{Name: "Permanent", Err: wallets.ErrInvalidAddress, Attempts: 1},
+			{Name: "Retryable", Err: errors.New("daemon is busy"), Attempts: 3},
+		}
+		for _, test := range tests {
+			t.Run(test.Name, func(t *testing.T) {
+				t.Parallel()
+				assertions := assert.New(t)
+
+				ctx, cancel := utils.NewContext()
+				defer cancel()
+
+				var alerts atomic.Uint64
+				ctrl, business := newController(t, gateway.Config{
+					Timeout: timeoutExtra + 30*time.Minute,
+					Wallet:  &failingWallet{Wallet: wallet, err: test.Err},
+					Retry: gateway.RetryConfig{
+						MaxAttempts: 3,
+						Backoff:     time.Millisecond,
+						Alert:       func(p *gateway.Payment, err error) { alerts.Add(1) },
+					},
+				})
+
+				payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+				fund(t, wallet, payment.Receiver.Address, gen.TransferAmount())
+
+				var paymentLatest gateway.Payment
+				for try := range 3_600 {
+					t.Log("\t[*] Try processing payments: ", try+1)
+
+					_, err := ctrl.ProcessPendingPayments(context.TODO())
+					assertions.Nil(err, "failed to process payments")
+
+					paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+					assertions.Nil(err, "failed to query payment")
+
+					if paymentLatest.Beneficiary.Status == gateway.StatusFailed {
+						break
+					}
+					time.Sleep(time.Second)
+				}
+
+				assertions.Equal(gateway.StatusFailed, paymentLatest.Beneficiary.Status, "beneficiary leg should fail")
+				assertions.Equal(test.Attempts, paymentLatest.Beneficiary.Attempts, "invalid number of attempts")
+				assertions.EqualValues(1, alerts.Load(), "failure should be alerted once")
+
+				processed, err := ctrl.ProcessPendingPayments(context.TODO())
+				assertions.Nil(err, "failed to process payments")
+				assertions.Zero(processed, "failed legs should not be retried automatically")
+
+				retried, err := ctrl.Retry(ctx, payment.Id)
+				assertions.Nil(err, "failed to retry payment")
+				assertions.Equal(gateway.StatusPending, retried.Beneficiary.Status, "leg should be pending again")
+				assertions.Zero(retried.Beneficiary.Attempts, "attempts should be reset")
+			})
+		}
+	})
+	t.Run("Journal", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout:       timeoutExtra + 30*time.Minute,
+			Wallet:        &crashingWallet{Wallet: wallet},
+			FeePercentage: 10,
+			Retry: gateway.RetryConfig{
+				Backoff: time.Millisecond,
+			},
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		fund(t, wallet, payment.Receiver.Address, payment.Amount)
+
+		var paymentLatest gateway.Payment
+		for try := range 3_600 {
+			t.Log("\t[*] Try processing payments: ", try+1)
+
+			_, err := ctrl.ProcessPendingPayments(context.TODO())
+			assertions.Nil(err, "failed to process payments")
+
+			paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+			assertions.Nil(err, "failed to query payment")
+
+			if paymentLatest.Beneficiary.Status == gateway.StatusError {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		assertions.Equal(gateway.StatusError, paymentLatest.Beneficiary.Status, "lost transfer should be reported as an error")
+
+		recovered, err := ctrl.Recover(ctx)
+		assertions.Nil(err, "failed to recover intents")
+		assertions.EqualValues(1, recovered, "transfer should be recovered from the wallet history")
+
+		// Waiting for the backoff of the failed attempt
+		time.Sleep(10 * time.Millisecond)
+		_, err = ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+
+		paymentLatest, err = ctrl.Query(ctx, payment.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusCompleted, paymentLatest.Beneficiary.Status, "recovered transfer should complete the leg")
+		assertions.NotEmpty(paymentLatest.Beneficiary.Transaction, "recovered transaction should be recorded")
+
+		outgoing, err := wallet.OutgoingTransfers(ctx, wallets.OutgoingTransfersRequest{Index: payment.Receiver.Index})
+		assertions.Nil(err, "failed to list outgoing transfers")
+		var payouts int
+		for _, o := range outgoing {
+			for _, destination := range o.Destinations {
+				if destination.Address == business.Address {
+					payouts++
+				}
+			}
+		}
+		assertions.Equal(1, payouts, "beneficiary should be payed once")
+
+		recovered, err = ctrl.Recover(ctx)
+		assertions.Nil(err, "failed to recover intents")
+		assertions.Zero(recovered, "intents should be deleted once the payment records the transfer")
+	})
+	t.Run("ViewOnly", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		signer, ok := wallet.(offlineSigner)
+		if !ok {
+			t.Skip("wallet can't sign offline")
+		}
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout:       timeoutExtra + 30*time.Minute,
+			Wallet:        wallet,
+			FeePercentage: 10,
+			ViewOnly:      true,
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		fund(t, wallet, payment.Receiver.Address, payment.Amount)
+
+		// Signs and submits the only queued transfer, which must belong to the leg
+		sign := func(leg string) {
+			batch, err := ctrl.Signing(ctx)
+			if !assertions.Nil(err, "failed to list unsigned transfers") || !assertions.Len(batch.Transfers, 1, "a single transfer should wait") {
+				return
+			}
+			assertions.NotEmpty(batch.Outputs, "outputs should be exported")
+
+			unsigned := batch.Transfers[0]
+			assertions.Equal(payment.Id, unsigned.Payment, "invalid payment")
+			assertions.Equal(leg, unsigned.Leg, "invalid leg")
+
+			signed, err := signer.Sign(unsigned.Transfer.Txset)
+			assertions.Nil(err, "failed to sign transfer")
+
+			submitted, err := ctrl.Submit(ctx, gateway.SignedBatch{
+				Transfers: []gateway.SignedTransfer{{Payment: unsigned.Payment, Leg: unsigned.Leg, Txset: signed}},
+			})
+			assertions.Nil(err, "failed to submit transfer")
+			assertions.EqualValues(1, submitted, "transfer should be submitted")
+		}
+
+		var paymentLatest gateway.Payment
+		for try := range 3_600 {
+			t.Log("\t[*] Try processing payments: ", try+1)
+
+			_, err := ctrl.ProcessPendingPayments(context.TODO())
+			assertions.Nil(err, "failed to process payments")
+
+			paymentLatest, err = ctrl.Query(ctx, payment.Id)
+			assertions.Nil(err, "failed to query payment")
+
+			if paymentLatest.Beneficiary.Status == gateway.StatusAwaitingSignature {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		assertions.Equal(gateway.StatusAwaitingSignature, paymentLatest.Beneficiary.Status, "beneficiary should wait for the signature")
+
+		// Nothing moves until the transfer is signed
+		_, err := ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+		paymentLatest, err = ctrl.Query(ctx, payment.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusAwaitingSignature, paymentLatest.Beneficiary.Status, "beneficiary should still wait for the signature")
+
+		sign(gateway.LegBeneficiary)
+
+		_, err = ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+		paymentLatest, err = ctrl.Query(ctx, payment.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusCompleted, paymentLatest.Beneficiary.Status, "submitted transfer should complete the beneficiary")
+		assertions.NotEmpty(paymentLatest.Beneficiary.Transaction, "submitted transaction should be recorded")
+
+		for try := range 3_600 {
+			t.Log("\t[*] Try processing fees: ", try+1)
+
+			_, err := ctrl.ProcessPendingFees(context.TODO())
+			assertions.Nil(err, "failed to process fees")
+
+			paymentLatest, err = ctrl.Query(ctx, payment.Id)
+			assertions.Nil(err, "failed to query payment")
+
+			if paymentLatest.Fee.Status == gateway.StatusAwaitingSignature {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		assertions.Equal(gateway.StatusAwaitingSignature, paymentLatest.Fee.Status, "fee should wait for the signature")
+
+		sign(gateway.LegFee)
+
+		_, err = ctrl.ProcessPendingFees(context.TODO())
+		assertions.Nil(err, "failed to process fees")
+		paymentLatest, err = ctrl.Query(ctx, payment.Id)
+		assertions.Nil(err, "failed to query payment")
+		assertions.Equal(gateway.StatusCompleted, paymentLatest.Fee.Status, "submitted transfer should complete the fee")
+
+		_, err = ctrl.Submit(ctx, gateway.SignedBatch{
+			Transfers: []gateway.SignedTransfer{{Payment: payment.Id, Leg: gateway.LegFee, Txset: "unknown"}},
+		})
+		assertions.ErrorIs(err, gateway.ErrNotAwaitingSignature, "recorded transfers can't be submitted again")
+	})
+
+	t.Run("Confirmations", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+			Confirmations: []gateway.ConfirmationTier{
+				{MaxAmount: ^uint64(0), Confirmations: 1},
+			},
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		fund(t, wallet, payment.Receiver.Address, gen.TransferAmount())
+
+		var paymentLatest gateway.Payment
+		for try := range 3_600 {
+			t.Log("\t[*] Try processing payments: ", try+1)
+
+			_, err := ctrl.ProcessPendingPayments(context.TODO())
+			assertions.Nil(err, "failed to process payments")
+
+			paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+			assertions.Nil(err, "failed to query payment")
+
+			status := paymentLatest.Beneficiary.Status
+			if status != gateway.StatusPending && status != gateway.StatusSeen {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+
+		assertions.Equal(gateway.StatusConfirmed, paymentLatest.Beneficiary.Status, "payment should be confirmed before unlocking")
+		assertions.Zero(paymentLatest.Beneficiary.Payed, "locked funds should not be forwarded")
+		assertions.Len(paymentLatest.Seen.Transactions, 1, "transfer should be seen in the pool")
+	})
+	t.Run("Quote", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		var rate, price decimal.Decimal
+		assertions.Nil(rate.FromString("200"), "failed to parse rate")
+		assertions.Nil(price.FromString("50"), "failed to parse price")
+
+		ctrl, business := newController(t, gateway.Config{
+			Timeout: timeoutExtra + 30*time.Minute,
+			Wallet:  wallet,
+			Oracle:  static.New(map[string]decimal.Decimal{"USD": rate}),
+		})
+
+		payment, err := ctrl.Receive(ctx, &gateway.Receive{
+			Address:  business.Address,
+			Currency: "usd",
+			Price:    price,
+			Priority: wallets.PriorityHigh,
+		})
+		assertions.Nil(err, "failed to create payment")
+		assertions.EqualValues(monero.MoneroUnit/4, payment.Amount, "amount should be converted with the rate")
+		if assertions.NotNil(payment.Quote, "quote should be stored") {
+			assertions.Equal("USD", payment.Quote.Currency, "invalid quote currency")
+			assertions.Equal(payment.Expiration, payment.Quote.Expiration, "quote should be locked until expiration")
+		}
+
+		_, err = ctrl.Receive(ctx, &gateway.Receive{
+			Address:  business.Address,
+			Currency: "EUR",
+			Price:    price,
+			Priority: wallets.PriorityHigh,
+		})
+		assertions.ErrorIs(err, oracles.ErrUnsupportedCurrency, "unknown currencies should fail")
+	})
+	t.Run("Refund", func(t *testing.T) {
+		t.Parallel()
+
+		type Test struct {
+			Name string
+			// Amount transferred expressed in halves of the payment amount
+			Halves            uint64
+			Timeout           time.Duration
+			BeneficiaryStatus gateway.Status
+			FeeStatus         gateway.Status
+		}
+		tests := []Test{
+			{Name: "Underpaid", Halves: 1, Timeout: 10 * time.Second, BeneficiaryStatus: gateway.StatusRefunded, FeeStatus: gateway.StatusRefunded},
+			{Name: "Overpaid", Halves: 4, Timeout: 30 * time.Minute, BeneficiaryStatus: gateway.StatusCompleted, FeeStatus: gateway.StatusCompleted},
+		}
+		for _, test := range tests {
+			t.Run(test.Name, func(t *testing.T) {
+				t.Parallel()
+				assertions := assert.New(t)
+
+				ctx, cancel := utils.NewContext()
+				defer cancel()
+
+				ctrl, business := newController(t, gateway.Config{
+					Timeout:       timeoutExtra + test.Timeout,
+					FeePercentage: 10,
+					Wallet:        wallet,
+					Refund:        gateway.RefundPolicy{Underpaid: true, Overpaid: true},
+				})
+
+				label := random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)
+				payerAddress, err := wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: label})
+				assertions.Nil(err, "failed to create payer address")
+
+				payment, err := ctrl.Receive(ctx, &gateway.Receive{
+					Address:       business.Address,
+					Amount:        gen.TransferAmount(),
+					Priority:      wallets.PriorityHigh,
+					RefundAddress: payerAddress.Address,
+				})
+				assertions.Nil(err, "failed to create payment")
+
+				fund(t, wallet, payment.Receiver.Address, gen.TransferAmount()/2*test.Halves)
+
+				var paymentLatest gateway.Payment
+				for try := range 3_600 {
+					t.Log("\t[*] Try processing payments: ", try+1)
+
+					_, err := ctrl.ProcessPendingPayments(context.TODO())
+					assertions.Nil(err, "failed to process payments")
+
+					_, err = ctrl.ProcessPendingRefunds(context.TODO())
+					assertions.Nil(err, "failed to process refunds")
+
+					paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+					assertions.Nil(err, "failed to query payment")
+
+					if paymentLatest.Refund.Status != "" && paymentLatest.Refund.Status != gateway.StatusPending {
+						break
+					}
+					time.Sleep(time.Second)
+				}
+
+				assertions.Equal(gateway.StatusCompleted, paymentLatest.Refund.Status, "invalid refund status")
+				assertions.Equal(test.BeneficiaryStatus, paymentLatest.Beneficiary.Status, "invalid beneficiary status")
+				assertions.NotZero(paymentLatest.Refund.Payed, "nothing refunded")
+
+				for try := range 3_600 {
+					t.Log("\t[*] Try processing fees: ", try+1)
+
+					processed, err := ctrl.ProcessPendingFees(context.TODO())
+					assertions.Nil(err, "failed to process fees")
+
+					paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+					assertions.Nil(err, "failed to query payment")
+
+					if processed == 0 || paymentLatest.Fee.Status != gateway.StatusPending {
+						break
+					}
+					time.Sleep(time.Second)
+				}
+				assertions.Equal(test.FeeStatus, paymentLatest.Fee.Status, "invalid fee status")
+			})
+		}
+	})
+	t.Run("LateDeposit", func(t *testing.T) {
+		t.Parallel()
+		assertions := assert.New(t)
+
+		ctrl, business := newController(t, gateway.Config{
+			Wallet:            wallet,
+			LateDepositPolicy: gateway.LateDepositReview,
+		})
+
+		payment := newPayment(t, &ctrl, business, gen.TransferAmount())
+
+		_, err := ctrl.ProcessPendingPayments(context.TODO())
+		assertions.Nil(err, "failed to process payments")
+
+		t.Log("[*] Transfering late funds")
+		fund(t, wallet, payment.Receiver.Address, gen.TransferAmount())
+
+		var paymentLatest gateway.Payment
+		for try := range 3_600 {
+			t.Log("\t[*] Try processing late deposits: ", try+1)
+
+			processed, err := ctrl.ProcessLateDeposits(context.TODO())
+			assertions.Nil(err, "failed to process late deposits")
+
+			paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
+			assertions.Nil(err, "failed to query payment")
+
+			if processed == 0 || len(paymentLatest.LateDeposits) > 0 {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+
+		assertions.Equal(gateway.StatusExpired, paymentLatest.Beneficiary.Status, "payment should remain expired")
+		if assertions.Len(paymentLatest.LateDeposits, 1, "late deposit not recorded") {
+			assertions.Equal(gateway.LateDepositReview, paymentLatest.LateDeposits[0].Action, "invalid action")
+			assertions.Equal(gateway.StatusReview, paymentLatest.LateDeposits[0].Status, "invalid status")
+			assertions.Equal(gen.TransferAmount(), paymentLatest.LateDeposits[0].Amount, "invalid amount")
+		}
+
+		processed, err := ctrl.ProcessLateDeposits(context.TODO())
+		assertions.Nil(err, "failed to process late deposits")
+		assertions.Zero(processed, "reviewed payment should not be scanned again")
+	})
 	t.Run("Succeed", func(t *testing.T) {
 		assertions := assert.New(t)
 
@@ -43,6 +978,7 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 			TransferDelay       time.Duration `yaml:"transfer-delay"`
 			ProcessPendingDelay time.Duration `yaml:"process-pending-delay"`
 			ProcessFeeDelay     time.Duration `yaml:"process-fee-delay"`
+			SingleTransaction   bool          `yaml:"single-transaction"`
 			Expect              Expect        `yaml:"expect"`
 		}
 
@@ -63,30 +999,37 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 				gatewayAddress, err := wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: label1})
 				assertions.Nil(err, "failed to create gateway address")
 
-				options := badger.
-					DefaultOptions("").
-					WithInMemory(true)
-				db, err := badger.Open(options)
-				assertions.Nil(err, "failed to open database")
-				var config = gateway.Config{
-					DB:            db,
-					Timeout:       timeoutExtra + test.Timeout,
-					FeePercentage: test.Fee,
-					Address:       gatewayAddress.Address,
-					Wallet:        wallet,
-				}
-				ctrl := gateway.New(config)
-				// t.Logf("Create controller: %+v", ctrl)
+				const webhookSecret = "secret"
+				var deliveries atomic.Uint64
+				webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := io.ReadAll(r.Body)
+					mac := hmac.New(sha256.New, []byte(webhookSecret))
+					mac.Write([]byte(r.Header.Get(gateway.SignatureTimestampHeader) + "."))
+					mac.Write(body)
+					if hex.EncodeToString(mac.Sum(nil)) != r.Header.Get(gateway.SignatureHeader) {
+						w.WriteHeader(http.StatusUnauthorized)
+						return
+					}
+					deliveries.Add(1)
+				}))
+				defer webhookServer.Close()
 
-				businessAddress, err := wallet.NewAddress(ctx, wallets.NewAddressRequest{Label: label1})
-				assertions.Nil(err, "failed to create business address")
+				ctrl, business := newController(t, gateway.Config{
+					Timeout:           timeoutExtra + test.Timeout,
+					FeePercentage:     test.Fee,
+					Address:           gatewayAddress.Address,
+					Wallet:            wallet,
+					Webhook:           gateway.WebhookConfig{Secret: webhookSecret, AllowPrivateNetworks: true},
+					SingleTransaction: test.SingleTransaction,
+				})
 
 				payment, err := ctrl.Receive(
 					context.TODO(),
 					&gateway.Receive{
-						Address:  businessAddress.Address,
-						Amount:   gen.TransferAmount(),
-						Priority: wallets.PriorityHigh,
+						Address:     business.Address,
+						Amount:      gen.TransferAmount(),
+						Priority:    wallets.PriorityHigh,
+						CallbackUrl: webhookServer.URL,
 					})
 				assertions.Nil(err, "failed to create payment")
 				// t.Logf("Create payment: %+v", payment)
@@ -103,14 +1046,7 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 					for range test.FullFillParts {
 						t.Log("[*] Transfer delay...", test.TransferDelay)
 						time.Sleep(test.TransferDelay)
-						transfer, err := wallet.Transfer(ctx, wallets.TransferRequest{
-							SourceIndex: 0,
-							Destination: payment.Receiver.Address,
-							Amount:      gen.TransferAmount() / test.Parts,
-							Priority:    wallets.PriorityHigh,
-							UnlockTime:  0,
-						})
-						assertions.Nil(err, "failed to transfer to destination")
+						transfer := fund(t, wallet, payment.Receiver.Address, gen.TransferAmount()/test.Parts)
 
 						cc, _ := json.Marshal(transfer)
 						t.Log("[+] Transfered:", string(cc))
@@ -125,14 +1061,15 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 				for try := range 3_600 {
 					t.Log("\t[*] Try processing payments: ", try+1)
 
-					processed, err := ctrl.ProcessPendingPayments()
+					processed, err := ctrl.ProcessPendingPayments(context.TODO())
 					assertions.Nil(err, "failed to process payments")
 
 					// Verify payment
 					paymentLatest, err = ctrl.Query(context.TODO(), payment.Id)
 					assertions.Nil(err, "failed to query payment")
 
-					if processed == 0 || paymentLatest.Beneficiary.Status != gateway.StatusPending {
+					status := paymentLatest.Beneficiary.Status
+					if processed == 0 || (status != gateway.StatusPending && status != gateway.StatusSeen && status != gateway.StatusConfirmed) {
 						break
 					}
 					time.Sleep(time.Second)
@@ -140,6 +1077,11 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 
 				assertions.Equal(test.Expect.BeneficiaryStatus, paymentLatest.Beneficiary.Status, "invalid benefiary status")
 
+				t.Log("[*] Delivering webhooks")
+				_, err = ctrl.ProcessPendingWebhooks(context.TODO())
+				assertions.Nil(err, "failed to process webhooks")
+				assertions.NotZero(deliveries.Load(), "no webhook delivered")
+
 				if test.Expect.BeneficiaryStatus == gateway.StatusExpired {
 					t.Log("[*] Early return expired payment doesn't have funds")
 					return
@@ -152,7 +1094,7 @@ func Test(t *testing.T, timeoutExtra time.Duration, wallet wallets.Wallet, gen D
 				for try := range 3_600 {
 					t.Log("\t[*] Try processing fees: ", try+1)
 
-					processed, err := ctrl.ProcessPendingFees()
+					processed, err := ctrl.ProcessPendingFees(context.TODO())
 					assertions.Nil(err, "failed to process fee")
 
 					// Verify payment
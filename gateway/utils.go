@@ -2,32 +2,85 @@ package gateway
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"slices"
 
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/metrics"
 	"github.com/RogueTeam/8ball/wallets"
 	badger "github.com/dgraph-io/badger/v4"
 )
 
-func (c *Controller) getReceiverAddress(ctx context.Context, r Receiver) (address wallets.Address, err error) {
-	log.Println("Querying address:", r.Index)
+// Balances of the receivers read in a single batch by a processing loop
+type balances map[uint64]wallets.Address
 
-	err = c.wallet.Sync(ctx, true)
+func (c *Controller) receiverBalances(ctx context.Context, payments []Payment) (b balances, err error) {
+	indices := make([]uint64, 0, len(payments))
+	for _, p := range payments {
+		indices = append(indices, p.Receiver.Index)
+	}
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+
+	addresses, err := wallets.Addresses(ctx, c.wallet, wallets.AddressesRequest{Indices: indices})
 	if err != nil {
-		return address, fmt.Errorf("failed to sync wallet: %w", err)
+		return nil, fmt.Errorf("failed to retrieve receiver balances: %w", err)
 	}
 
-	address, err = c.wallet.Address(ctx, wallets.AddressRequest{Index: r.Index})
+	b = make(balances, len(addresses))
+	for _, address := range addresses {
+		b[address.Index] = address
+	}
+	return b, nil
+}
+
+// Incoming transfers of the receivers still waiting for their funds, read in a single batch by the
+// payments loop. Receivers without transfers are missing
+type incoming map[uint64][]wallets.IncomingTransfer
+
+func (c *Controller) receiverIncoming(ctx context.Context, payments []Payment) (i incoming, err error) {
+	indices := make([]uint64, 0, len(payments))
+	for _, p := range payments {
+		if p.Beneficiary.Status == StatusPending || p.Beneficiary.Status == StatusSeen {
+			indices = append(indices, p.Receiver.Index)
+		}
+	}
+	slices.Sort(indices)
+	indices = slices.Compact(indices)
+
+	i, err = wallets.IncomingTransfersBatch(ctx, c.wallet, wallets.IncomingTransfersBatchRequest{Indices: indices, Pool: true})
 	if err != nil {
-		return address, fmt.Errorf("failed to retrieve address: %w", err)
+		return nil, fmt.Errorf("failed to retrieve receiver transfers: %w", err)
+	}
+	if i == nil {
+		i = make(incoming)
+	}
+	return i, nil
+}
+
+// Returns the receiver from the balances read by the loop. Receivers missing from them are queried
+func (c *Controller) getReceiverAddress(ctx context.Context, r Receiver, balances balances) (address wallets.Address, err error) {
+	logger := c.logger.With(logging.KeyReceiver, r.Index)
+
+	address, found := balances[r.Index]
+	if !found {
+		logger.Debug("querying address")
+
+		address, err = c.wallet.Address(ctx, wallets.AddressRequest{Index: r.Index})
+		if err != nil {
+			return address, fmt.Errorf("failed to retrieve address: %w", err)
+		}
 	}
 
-	cc, _ := json.MarshalIndent(address, "", "\t")
-	log.Println(string(cc))
+	logger.Debug("address queried",
+		logging.KeyAddress, address.Address,
+		"balance", address.Balance,
+		"unlocked", address.UnlockedBalance,
+	)
 
 	if address.Address != r.Address {
-		return address, fmt.Errorf("expecting a different address: %s != %s; did server wallet changed?", r.Address, address.Address)
+		return address, errors.New("expecting a different address; did server wallet changed?")
 	}
 	return address, nil
 }
@@ -46,25 +99,95 @@ func (c *Controller) savePendingFee(p Payment) (err error) {
 	})
 }
 
+// This utility function is used for those scenarios in which the payment has changed state
+func (c *Controller) savePendingRefund(p Payment) (err error) {
+	return c.db.Update(func(txn *badger.Txn) (err error) {
+		err = txn.Set(RefundKey(p.Id), p.Id[:])
+		if err != nil {
+			return fmt.Errorf("failed to set new payment at key:m %w", err)
+		}
+		return nil
+	})
+}
+
 // This utility function is used for those scenarios in which the payment has changed state
 func (c *Controller) savePaymentState(p Payment) (err error) {
-	cc, _ := json.MarshalIndent(p, "", "\t")
-	log.Println("Saving payment:", string(cc))
+	c.logger.Debug("saving payment",
+		logging.KeyPayment, p.Id,
+		logging.KeyReceiver, p.Receiver.Index,
+		LegBeneficiary, p.Beneficiary.Status,
+		LegFee, p.Fee.Status,
+		LegRefund, p.Refund.Status,
+	)
+
+	var previous Payment
+	err = c.db.Update(func(txn *badger.Txn) (err error) {
+		item, err := txn.Get(PaymentKey(p.Id))
+		if err != nil {
+			return fmt.Errorf("failed to retrieve previous payment state: %w", err)
+		}
+		err = item.Value(previous.FromBytes)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal previous payment state: %w", err)
+		}
 
-	return c.db.Update(func(txn *badger.Txn) (err error) {
 		contents := p.Bytes()
 
 		err = txn.Set(PaymentKey(p.Id), contents)
 		if err != nil {
 			return fmt.Errorf("failed to set new payment at key:m %w", err)
 		}
+
+		err = updateIndexes(txn, &previous, &p)
+		if err != nil {
+			return fmt.Errorf("failed to update indexes: %w", err)
+		}
+
+		err = queueDelivery(txn, &previous, &p)
+		if err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+
+		err = deleteIntents(txn, &p)
+		if err != nil {
+			return fmt.Errorf("failed to delete intents: %w", err)
+		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	c.observeTransition(&previous, &p)
+	c.broker.publish(p)
+	return nil
+}
+
+// Reports the status changes and funds moved by the new state of the payment
+func (c *Controller) observeTransition(previous, current *Payment) {
+	if previous.Beneficiary.Status != current.Beneficiary.Status {
+		c.metrics.Transition(LegBeneficiary, string(current.Beneficiary.Status))
+	}
+	if previous.Fee.Status != current.Fee.Status {
+		c.metrics.Transition(LegFee, string(current.Fee.Status))
+	}
+	if previous.Refund.Status != current.Refund.Status {
+		c.metrics.Transition(LegRefund, string(current.Refund.Status))
+	}
+	if current.Beneficiary.Payed > previous.Beneficiary.Payed {
+		c.metrics.Amount(metrics.AmountForwarded, current.Beneficiary.Payed-previous.Beneficiary.Payed)
+	}
+	if current.Fee.Payed > previous.Fee.Payed {
+		c.metrics.Amount(metrics.AmountFee, current.Fee.Payed-previous.Fee.Payed)
+	}
+	if current.Refund.Payed > previous.Refund.Payed {
+		c.metrics.Amount(metrics.AmountRefunded, current.Refund.Payed-previous.Refund.Payed)
+	}
 }
 
 // This is a utility function that should be called just in case something goes wrong while processing a pending payment
 func (c *Controller) deleteKey(key []byte) (err error) {
-	log.Println("Deleting entry")
+	c.logger.Debug("deleting entry", "key", string(key))
 	return c.db.Update(func(txn *badger.Txn) (err error) {
 		err = txn.Delete(key)
 		if err != nil {
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+var ErrNotifierUnsupported = errors.New("wallet doesn't support notifications")
+
+// Watch processes the pending payments as soon as the wallet notifies funds in their receivers
+// until the context is canceled. The payments loop remains as a safety net for the missed events
+func (c *Controller) Watch(ctx context.Context) (err error) {
+	notifier, ok := c.wallet.(wallets.Notifier)
+	if !ok {
+		return ErrNotifierUnsupported
+	}
+
+	events, err := notifier.Subscribe(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to wallet events: %w", err)
+	}
+
+	for event := range events {
+		err := c.processEvent(event)
+		if err != nil {
+			c.logger.Error("failed to process wallet event",
+				logging.KeyReceiver, event.Index,
+				logging.KeyTransaction, event.TransactionId,
+				"event", event.Type,
+				logging.KeyError, err,
+			)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) processEvent(event wallets.Event) (err error) {
+	c.pending.Lock()
+	defer c.pending.Unlock()
+
+	p, found, err := c.pendingPayment(event.Index)
+	if err != nil {
+		return err
+	}
+	// Receivers of finalized payments are left to the late deposits scan
+	if !found {
+		return nil
+	}
+
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	err = c.sync(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.processPayment(ctx, p, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to process payment: %w", err)
+	}
+	return nil
+}
+
+// Returns the pending payment owning the receiver
+func (c *Controller) pendingPayment(index uint64) (p Payment, found bool, err error) {
+	err = c.db.View(func(txn *badger.Txn) (err error) {
+		item, err := txn.Get(ReceiverKey(index))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve receiver owner: %w", err)
+		}
+		var id uuid.UUID
+		err = item.Value(func(val []byte) (err error) {
+			id, err = uuid.FromBytes(val)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to parse receiver owner: %w", err)
+		}
+
+		_, err = txn.Get(PendingKey(id))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to retrieve pending entry: %w", err)
+		}
+
+		item, err = txn.Get(PaymentKey(id))
+		if err != nil {
+			return fmt.Errorf("failed to retrieve payment: %w", err)
+		}
+		err = item.Value(p.FromBytes)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal payment: %w", err)
+		}
+		found = true
+		return nil
+	})
+	return p, found, err
+}
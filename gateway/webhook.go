@@ -0,0 +1,323 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/RogueTeam/8ball/utils"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	// Unix timestamp of the moment the delivery was signed
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// Hex encoded HMAC-SHA256 of "<timestamp>.<body>" using the webhook secret
+	SignatureHeader = "X-Signature"
+)
+
+const (
+	DefaultWebhookMaxAttempts = 10
+	DefaultWebhookBackoff     = 10 * time.Second
+	DefaultWebhookMaxBackoff  = time.Hour
+	DefaultWebhookTimeout     = 30 * time.Second
+)
+
+type WebhookConfig struct {
+	// Secret used to sign the deliveries with HMAC-SHA256
+	Secret string
+	// Maximum number of attempts before discarding a delivery
+	MaxAttempts uint64
+	// Delay after the first failed attempt. Doubled on every retry
+	Backoff time.Duration
+	// Maximum delay between attempts
+	MaxBackoff time.Duration
+	// Timeout of every delivery attempt
+	Timeout time.Duration
+	// Converts the payment into the body to deliver. Defaults to the JSON encoding of the payment
+	Payload func(p *Payment) (body []byte, err error)
+	// Allows deliveries to loopback, private and link-local addresses. Callback urls are chosen
+	// by the payers so this exposes the internal network of the gateway
+	AllowPrivateNetworks bool
+}
+
+var ErrForbiddenDestination = errors.New("callback destination is not a public address")
+
+// Rejects the connections to addresses that are not publicly routable. Checked at dial time
+// so hostnames resolving to internal addresses and redirects are rejected too
+func publicOnly(network, address string, _ syscall.RawConn) (err error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrForbiddenDestination, ip)
+	}
+	return nil
+}
+
+// HTTP client used to deliver the notifications
+func (w *WebhookConfig) client() (client *http.Client) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !w.AllowPrivateNetworks {
+		// Proxies would be the only address checked
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   publicOnly,
+		}).DialContext
+	}
+	return &http.Client{Timeout: w.Timeout, Transport: transport}
+}
+
+// Pending notification of a payment state transition
+type Delivery struct {
+	// Identifier of the delivery
+	Id uuid.UUID
+	// Url to notify
+	Url string
+	// Snapshot of the payment at the moment of the transition
+	Payment Payment
+	// Number of failed attempts
+	Attempts uint64
+	// Time of the next attempt
+	NextAttempt time.Time
+	// Error of the last attempt
+	Error string
+}
+
+func (d *Delivery) Bytes() (bytes []byte) {
+	bytes, _ = json.Marshal(d)
+	return bytes
+}
+
+func (d *Delivery) FromBytes(b []byte) (err error) {
+	return json.Unmarshal(b, d)
+}
+
+func (w *WebhookConfig) setDefaults() {
+	if w.MaxAttempts == 0 {
+		w.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if w.Backoff == 0 {
+		w.Backoff = DefaultWebhookBackoff
+	}
+	if w.MaxBackoff == 0 {
+		w.MaxBackoff = DefaultWebhookMaxBackoff
+	}
+	if w.Timeout == 0 {
+		w.Timeout = DefaultWebhookTimeout
+	}
+	if w.Payload == nil {
+		w.Payload = func(p *Payment) (body []byte, err error) { return json.Marshal(p) }
+	}
+}
+
+// Signs the body of a delivery
+func sign(secret, timestamp string, body []byte) (signature string) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Queues a notification for the payment in case its status changed. Called inside the same
+// transaction that saves the payment so the transition is never lost
+func queueDelivery(txn *badger.Txn, previous, current *Payment) (err error) {
+	if current.CallbackUrl == "" {
+		return nil
+	}
+	if previous.Beneficiary.Status == current.Beneficiary.Status &&
+		previous.Fee.Status == current.Fee.Status &&
+		previous.Refund.Status == current.Refund.Status &&
+		len(previous.LateDeposits) == len(current.LateDeposits) {
+		return nil
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate delivery id: %w", err)
+	}
+
+	delivery := Delivery{
+		Id:          id,
+		Url:         current.CallbackUrl,
+		Payment:     *current,
+		NextAttempt: time.Now(),
+	}
+	err = txn.Set(WebhookKey(delivery.Id), delivery.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	return nil
+}
+
+func (c *Controller) deliver(ctx context.Context, d *Delivery) (err error) {
+	body, err := c.webhook.Payload(&d.Payment)
+	if err != nil {
+		return fmt.Errorf("failed to prepare payload: %w", err)
+	}
+
+	// Merchants may sign with their own secret
+	secret := c.webhook.Secret
+	if d.Payment.Merchant != uuid.Nil {
+		merchant, err := c.Merchant(ctx, d.Payment.Merchant)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve merchant: %w", err)
+		}
+		if merchant.Webhook.Secret != "" {
+			secret = merchant.Webhook.Secret
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to prepare request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, sign(secret, timestamp, body))
+
+	res, err := c.webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (c *Controller) processDelivery(ctx context.Context, d Delivery) (err error) {
+	if time.Now().Before(d.NextAttempt) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, utils.DefaultTimeout)
+	defer cancel()
+
+	err = c.deliver(ctx, &d)
+	if err == nil {
+		return c.deleteKey(WebhookKey(d.Id))
+	}
+
+	d.Attempts++
+	d.Error = err.Error()
+	if d.Attempts >= c.webhook.MaxAttempts {
+		c.logger.Warn("discarding webhook delivery",
+			"delivery", d.Id,
+			logging.KeyPayment, d.Payment.Id,
+			"attempts", d.Attempts,
+			logging.KeyError, err,
+		)
+		return c.deleteKey(WebhookKey(d.Id))
+	}
+	d.NextAttempt = time.Now().Add(utils.Backoff(c.webhook.Backoff, c.webhook.MaxBackoff, d.Attempts))
+
+	saveErr := c.db.Update(func(txn *badger.Txn) (err error) {
+		return txn.Set(WebhookKey(d.Id), d.Bytes())
+	})
+	if saveErr != nil {
+		return fmt.Errorf("failed to save delivery: %w", saveErr)
+	}
+	return fmt.Errorf("failed to deliver: %w", err)
+}
+
+// Streams queued deliveries into a channel
+func (c *Controller) streamDeliveries() (deliveries chan Delivery, err chan error) {
+	deliveries = make(chan Delivery, 1_000)
+	err = make(chan error, 1)
+	go func() {
+		defer close(deliveries)
+		defer close(err)
+
+		err <- c.db.View(func(txn *badger.Txn) (err error) {
+			options := badger.DefaultIteratorOptions
+			options.Prefix = webhookPrefixBytes
+			it := txn.NewIterator(options)
+			defer it.Close()
+
+			for it.Rewind(); it.ValidForPrefix(webhookPrefixBytes); it.Next() {
+				var delivery Delivery
+				err = it.Item().Value(delivery.FromBytes)
+				if err != nil {
+					c.logger.Error("failed to retrieve delivery", logging.KeyError, err)
+					continue
+				}
+
+				deliveries <- delivery
+			}
+			return nil
+		})
+	}()
+	return deliveries, err
+}
+
+// ProcessPendingWebhooks goes over all queued deliveries and notifies the merchants
+func (c *Controller) ProcessPendingWebhooks(iteration context.Context) (processed uint64, err error) {
+	defer func(start time.Time) { c.metrics.Loop("webhooks", start, processed) }(time.Now())
+
+	deliveries, errChan := c.streamDeliveries()
+	defer utils.ConsumeChannel(deliveries)
+	defer utils.ConsumeChannel(errChan)
+
+	var jobs = utils.NewJobPool(MaxConcurrentJobs)
+	var wg sync.WaitGroup
+	for delivery := range deliveries {
+		// Canceled iterations stop dispatching deliveries
+		if iteration.Err() != nil {
+			break
+		}
+		processed++
+		jobs.Get()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer jobs.Put()
+
+			err := c.processDelivery(iteration, delivery)
+			if err != nil {
+				c.logger.Error("failed to process webhook delivery",
+					"delivery", delivery.Id,
+					logging.KeyPayment, delivery.Payment.Id,
+					logging.KeyError, err,
+				)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	err = <-errChan
+	if err != nil {
+		return processed, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+	return processed, nil
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RogueTeam/8ball/wallets/mock"
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Deliver(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	type Test struct {
+		Name                 string
+		AllowPrivateNetworks bool
+		Url                  string
+		Forbidden            bool
+	}
+	tests := []Test{
+		{Name: "Loopback", Url: server.URL, Forbidden: true},
+		{Name: "Private", Url: "http://10.0.0.1:8080", Forbidden: true},
+		{Name: "LinkLocal", Url: "http://169.254.169.254/latest/meta-data", Forbidden: true},
+		{Name: "Unspecified", Url: "http://0.0.0.0:8080", Forbidden: true},
+		{Name: "Allowed", Url: server.URL, AllowPrivateNetworks: true},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			t.Parallel()
+			assertions := assert.New(t)
+
+			db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true))
+			if !assertions.Nil(err, "failed to open database") {
+				return
+			}
+			defer db.Close()
+
+			c := New(Config{
+				DB:        db,
+				Wallet:    mock.New(mock.Config{}),
+				MaxAmount: ^uint64(0),
+				Webhook:   WebhookConfig{AllowPrivateNetworks: test.AllowPrivateNetworks},
+			})
+
+			err = c.deliver(context.TODO(), &Delivery{Id: uuid.New(), Url: test.Url})
+			if test.Forbidden {
+				assertions.ErrorIs(err, ErrForbiddenDestination, "destination should be rejected")
+				return
+			}
+			assertions.Nil(err, "delivery should succeed")
+		})
+	}
+}
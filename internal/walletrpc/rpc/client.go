@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/RogueTeam/8ball/internal/walletrpc/rpc/json2"
 )
@@ -12,8 +13,9 @@ import (
 // New returns a new monero-wallet-rpc client.
 func New(cfg Config) *Client {
 	cl := &Client{
-		addr:    cfg.Url,
-		headers: cfg.CustomHeaders,
+		addr:     cfg.Url,
+		headers:  cfg.CustomHeaders,
+		observer: cfg.Observer,
 	}
 	if cfg.Client == nil {
 		cl.httpcl = http.DefaultClient
@@ -24,12 +26,22 @@ func New(cfg Config) *Client {
 }
 
 type Client struct {
-	httpcl  *http.Client
-	addr    string
-	headers map[string]string
+	httpcl   *http.Client
+	addr     string
+	headers  map[string]string
+	observer func(method string, duration time.Duration, err error)
 }
 
-func (c *Client) Do(ctx context.Context, method string, in, out interface{}) error {
+func (c *Client) Do(ctx context.Context, method string, in, out interface{}) (err error) {
+	if c.observer != nil {
+		defer func(start time.Time) {
+			c.observer(method, time.Since(start), err)
+		}(time.Now())
+	}
+	return c.do(ctx, method, in, out)
+}
+
+func (c *Client) do(ctx context.Context, method string, in, out interface{}) error {
 	payload, err := json2.EncodeClientRequest(method, in)
 	if err != nil {
 		return err
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"net/http"
+	"time"
 )
 
 // Config holds the configuration of a monero rpc client.
@@ -13,4 +14,6 @@ type Config struct {
 	CustomHeaders map[string]string
 	// HTTP Client to use
 	Client *http.Client
+	// Optional hook called after every call with its method, latency and error
+	Observer func(method string, duration time.Duration, err error)
 }
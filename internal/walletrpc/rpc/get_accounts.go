@@ -9,7 +9,7 @@ type GetAccountsRequest struct {
 
 type GetAccountsResponse struct {
 	// Array of subaddress account information.
-	SubaddressAccounts []Address `json:"subaddress_accounts"`
+	SubaddressAccounts []Account `json:"subaddress_accounts"`
 
 	// Total balance of the selected accounts (locked or unlocked).
 	TotalBalance uint64 `json:"total_balance"`
@@ -18,6 +18,26 @@ type GetAccountsResponse struct {
 	TotalUnlockedBalance uint64 `json:"total_unlocked_balance"`
 }
 
+type Account struct {
+	// AccountIndex Index of the account.
+	AccountIndex uint64 `json:"account_index"`
+
+	// BaseAddress Base58 representation of the first subaddress in the account.
+	BaseAddress string `json:"base_address"`
+
+	// Balance of the account (locked or unlocked).
+	Balance uint64 `json:"balance"`
+
+	// UnlockedBalance Unlocked balance for the account.
+	UnlockedBalance uint64 `json:"unlocked_balance"`
+
+	// Label of the account.
+	Label string `json:"label"`
+
+	// Tag for filtering accounts.
+	Tag string `json:"tag"`
+}
+
 // Get all accounts for a wallet. Optionally filter accounts by tag.
 func (c *Client) GetAccounts(ctx context.Context, req *GetAccountsRequest) (*GetAccountsResponse, error) {
 	resp := &GetAccountsResponse{}
@@ -32,6 +32,9 @@ type GetTransfersRequest struct {
 
 	// (Optional) List of subaddress indices to query for transfers. (Defaults to empty - all indices)
 	SubaddrIndices []uint64 `json:"subaddr_indices,omitempty"`
+
+	// (Optional) Query the transfers of every account. (Defaults to false)
+	AllAccounts bool `json:"all_accounts,omitempty"`
 }
 
 type Transfer struct {
@@ -41,6 +44,9 @@ type Transfer struct {
 	// Amount of this transfer.
 	Amount uint64 `json:"amount"`
 
+	// Destinations of an outgoing transfer. Only known by the wallet that sent it.
+	Destinations []Destination `json:"destinations,omitempty"`
+
 	// Number of blocks mined since the block containing this transaction (or block height at which the transaction should be added to a block if not yet confirmed).
 	Confirmations uint64 `json:"confirmations"`
 
@@ -62,6 +68,9 @@ type Transfer struct {
 	// Account and subaddress index.
 	SubaddrIndex SubaddressIndex `json:"subaddr_index"`
 
+	// Subaddresses spent by an outgoing transfer.
+	SubaddrIndices []SubaddressIndex `json:"subaddr_indices"`
+
 	// Estimation of the confirmations needed for the transaction to be included in a block.
 	SuggestedConfirmationsThreshold uint64 `json:"suggested_confirmations_threshold"`
 
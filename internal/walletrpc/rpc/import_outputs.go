@@ -4,7 +4,7 @@ import "context"
 
 type ImportOutputsRequest struct {
 	// Wallet outputs in hex format.
-	OutputsDataHex int64 `json:"outputs_data_hex"`
+	OutputsDataHex string `json:"outputs_data_hex"`
 }
 
 type ImportOutputsResponse struct {
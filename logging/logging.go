@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Attribute keys shared by the gateway loggers
+const (
+	KeyPayment     = "payment"
+	KeyReceiver    = "receiver"
+	KeyLeg         = "leg"
+	KeyMerchant    = "merchant"
+	KeyAddress     = "address"
+	KeyDestination = "destination"
+	KeyTransaction = "transaction"
+	KeyError       = "error"
+)
+
+// Value printed in place of the sensitive attributes
+const Redacted = "[redacted]"
+
+// Attributes hidden unless Config.Reveal is set
+var sensitive = map[string]bool{
+	KeyAddress:     true,
+	KeyDestination: true,
+	KeyTransaction: true,
+}
+
+type Config struct {
+	// Destination of the records. Defaults to stderr
+	Output io.Writer
+	// Minimum level of the records written
+	Level slog.Level
+	// Writes the records as JSON instead of key=value text
+	JSON bool
+	// Prints addresses and transaction hashes. They are redacted by default
+	Reveal bool
+}
+
+// New creates a logger that redacts the sensitive attributes
+func New(config Config) (logger *slog.Logger) {
+	output := config.Output
+	if output == nil {
+		output = os.Stderr
+	}
+
+	options := &slog.HandlerOptions{Level: config.Level}
+	if !config.Reveal {
+		options.ReplaceAttr = redact
+	}
+
+	var handler slog.Handler
+	if config.JSON {
+		handler = slog.NewJSONHandler(output, options)
+	} else {
+		handler = slog.NewTextHandler(output, options)
+	}
+	return slog.New(handler)
+}
+
+func redact(groups []string, a slog.Attr) (attr slog.Attr) {
+	if sensitive[a.Key] && a.Value.String() != "" {
+		a.Value = slog.StringValue(Redacted)
+	}
+	return a
+}
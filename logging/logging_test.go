@@ -0,0 +1,53 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/RogueTeam/8ball/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	t.Run("Redacted", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		var buffer bytes.Buffer
+		logger := logging.New(logging.Config{Output: &buffer, JSON: true})
+		logger.Info("transfer",
+			logging.KeyPayment, "id",
+			logging.KeyAddress, "4Address",
+			logging.KeyTransaction, "hash",
+		)
+
+		var record map[string]any
+		assertions.Nil(json.Unmarshal(buffer.Bytes(), &record))
+		assertions.Equal("id", record[logging.KeyPayment])
+		assertions.Equal(logging.Redacted, record[logging.KeyAddress])
+		assertions.Equal(logging.Redacted, record[logging.KeyTransaction])
+	})
+	t.Run("Reveal", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		var buffer bytes.Buffer
+		logger := logging.New(logging.Config{Output: &buffer, JSON: true, Reveal: true})
+		logger.Info("transfer", logging.KeyAddress, "4Address")
+
+		var record map[string]any
+		assertions.Nil(json.Unmarshal(buffer.Bytes(), &record))
+		assertions.Equal("4Address", record[logging.KeyAddress])
+	})
+	t.Run("Level", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		var buffer bytes.Buffer
+		logger := logging.New(logging.Config{Output: &buffer, Level: slog.LevelWarn})
+		logger.Info("ignored")
+		assertions.Zero(buffer.Len())
+
+		logger.Warn("written")
+		assertions.Contains(buffer.String(), "written")
+	})
+}
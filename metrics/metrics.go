@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gateway"
+
+// Atomic units of a single XMR
+const atomicUnits = 1_000_000_000_000
+
+// Kinds of the amounts moved by the gateway
+const (
+	AmountReceived  = "received"
+	AmountForwarded = "forwarded"
+	AmountFee       = "fee"
+	AmountRefunded  = "refunded"
+)
+
+// Prometheus collectors of the gateway. Every method can be called over a nil *Metrics
+// so instrumented code doesn't need to check if metrics are enabled
+type Metrics struct {
+	paymentsCreated prometheus.Counter
+	transitions     *prometheus.CounterVec
+	loopDuration    *prometheus.HistogramVec
+	loopProcessed   *prometheus.GaugeVec
+	rpcDuration     *prometheus.HistogramVec
+	rpcErrors       *prometheus.CounterVec
+	amounts         *prometheus.CounterVec
+}
+
+// New creates the collectors and registers them
+func New(reg prometheus.Registerer) (m *Metrics) {
+	m = &Metrics{
+		paymentsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_created_total",
+			Help:      "Payments created.",
+		}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "status_transitions_total",
+			Help:      "Status changes of every leg of the payments.",
+		}, []string{"leg", "status"}),
+		loopDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "process_duration_seconds",
+			Help:      "Duration of the processing loops.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"loop"}),
+		loopProcessed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "process_entries",
+			Help:      "Entries processed by the last run of the processing loops.",
+		}, []string{"loop"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "wallet_rpc_duration_seconds",
+			Help:      "Latency of the wallet RPC calls.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		rpcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wallet_rpc_errors_total",
+			Help:      "Failed wallet RPC calls.",
+		}, []string{"method"}),
+		amounts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "amount_xmr_total",
+			Help:      "XMR received, forwarded to beneficiaries, collected as fees and refunded.",
+		}, []string{"kind"}),
+	}
+	reg.MustRegister(
+		m.paymentsCreated,
+		m.transitions,
+		m.loopDuration,
+		m.loopProcessed,
+		m.rpcDuration,
+		m.rpcErrors,
+		m.amounts,
+	)
+	return m
+}
+
+func (m *Metrics) PaymentCreated() {
+	if m == nil {
+		return
+	}
+	m.paymentsCreated.Inc()
+}
+
+func (m *Metrics) Transition(leg, status string) {
+	if m == nil {
+		return
+	}
+	m.transitions.WithLabelValues(leg, status).Inc()
+}
+
+// Loop observes the duration of a processing loop and the entries it processed
+func (m *Metrics) Loop(loop string, start time.Time, processed uint64) {
+	if m == nil {
+		return
+	}
+	m.loopDuration.WithLabelValues(loop).Observe(time.Since(start).Seconds())
+	m.loopProcessed.WithLabelValues(loop).Set(float64(processed))
+}
+
+// Rpc matches the observer hook of the wallet RPC client
+func (m *Metrics) Rpc(method string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.rpcDuration.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil {
+		m.rpcErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// Amount adds atomic units to the amount of the kind
+func (m *Metrics) Amount(kind string, amount uint64) {
+	if m == nil || amount == 0 {
+		return
+	}
+	m.amounts.WithLabelValues(kind).Add(float64(amount) / atomicUnits)
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("Nil", func(t *testing.T) {
+		var m *Metrics
+		assert.NotPanics(t, func() {
+			m.PaymentCreated()
+			m.Transition("beneficiary", "completed")
+			m.Loop("payments", time.Now(), 1)
+			m.Rpc("transfer", time.Second, nil)
+			m.Amount(AmountReceived, 1)
+		}, "disabled metrics should be ignored")
+	})
+	t.Run("Record", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		reg := prometheus.NewRegistry()
+		m := New(reg)
+
+		m.PaymentCreated()
+		m.PaymentCreated()
+		assertions.Equal(2.0, testutil.ToFloat64(m.paymentsCreated), "invalid payments created")
+
+		m.Transition("fee", "completed")
+		assertions.Equal(1.0, testutil.ToFloat64(m.transitions.WithLabelValues("fee", "completed")), "invalid transitions")
+
+		m.Loop("payments", time.Now(), 7)
+		assertions.Equal(7.0, testutil.ToFloat64(m.loopProcessed.WithLabelValues("payments")), "invalid processed entries")
+
+		m.Rpc("transfer", time.Second, nil)
+		m.Rpc("transfer", time.Second, errors.New("daemon is busy"))
+		assertions.Equal(1.0, testutil.ToFloat64(m.rpcErrors.WithLabelValues("transfer")), "invalid rpc errors")
+		assertions.Equal(1, testutil.CollectAndCount(m.rpcDuration), "invalid rpc methods")
+
+		m.Amount(AmountFee, atomicUnits/2)
+		assertions.Equal(0.5, testutil.ToFloat64(m.amounts.WithLabelValues(AmountFee)), "amounts should be in XMR")
+	})
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/oracles"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+type Config struct {
+	// Url answering GET requests with a JSON object mapping currencies to the price of a single XMR:
+	//
+	//	{"EUR": "150.25", "USD": "162.10"}
+	Url string
+	// Client used for the requests. Defaults to a client with DefaultTimeout
+	Client *http.Client
+}
+
+// Oracle retrieving the exchange rates from a local HTTP service
+type Oracle struct {
+	url    string
+	client *http.Client
+}
+
+var _ oracles.Oracle = (*Oracle)(nil)
+
+func New(config Config) (o *Oracle) {
+	o = &Oracle{
+		url:    config.Url,
+		client: config.Client,
+	}
+	if o.client == nil {
+		o.client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return o
+}
+
+func (o *Oracle) Rate(ctx context.Context, req oracles.RateRequest) (rate oracles.Rate, err error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, o.url, nil)
+	if err != nil {
+		return rate, fmt.Errorf("failed to prepare request: %w", err)
+	}
+
+	res, err := o.client.Do(httpReq)
+	if err != nil {
+		return rate, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return rate, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var rates map[string]decimal.Decimal
+	err = json.NewDecoder(res.Body).Decode(&rates)
+	if err != nil {
+		return rate, fmt.Errorf("failed to decode rates: %w", err)
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	for key, price := range rates {
+		if strings.ToUpper(key) != currency {
+			continue
+		}
+
+		rate = oracles.Rate{
+			Currency: currency,
+			Price:    price,
+			Time:     time.Now(),
+		}
+		return rate, nil
+	}
+	return rate, fmt.Errorf("%w: %s", oracles.ErrUnsupportedCurrency, req.Currency)
+}
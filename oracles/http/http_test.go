@@ -0,0 +1,41 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RogueTeam/8ball/oracles"
+	oraclehttp "github.com/RogueTeam/8ball/oracles/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Http(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"EUR": "150.25", "USD": "162.1"}`))
+	}))
+	defer server.Close()
+
+	t.Run("Succeed", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		oracle := oraclehttp.New(oraclehttp.Config{Url: server.URL})
+		rate, err := oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "eur"})
+		assertions.Nil(err, "failed to retrieve rate")
+		assertions.Equal("EUR", rate.Currency, "invalid currency")
+		assertions.Equal("150.25", rate.Price.Value.Text('f', 2), "invalid price")
+	})
+	t.Run("Fail", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		oracle := oraclehttp.New(oraclehttp.Config{Url: server.URL})
+		_, err := oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "JPY"})
+		assertions.ErrorIs(err, oracles.ErrUnsupportedCurrency, "currency should not be supported")
+
+		oracle = oraclehttp.New(oraclehttp.Config{Url: server.URL + "/%zz"})
+		_, err = oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "EUR"})
+		assertions.NotNil(err, "invalid url should fail")
+	})
+}
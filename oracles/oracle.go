@@ -0,0 +1,31 @@
+package oracles
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RogueTeam/8ball/decimal"
+)
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+type (
+	RateRequest struct {
+		// Currency code like EUR or USD
+		Currency string
+	}
+	Rate struct {
+		// Currency code of the price
+		Currency string
+		// Price of a single XMR expressed in the currency
+		Price decimal.Decimal
+		// Moment the price was retrieved
+		Time time.Time
+	}
+)
+
+type Oracle interface {
+	// Returns the exchange rate of XMR in the requested currency
+	Rate(ctx context.Context, req RateRequest) (rate Rate, err error)
+}
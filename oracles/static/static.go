@@ -0,0 +1,62 @@
+package static
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RogueTeam/8ball/decimal"
+	"github.com/RogueTeam/8ball/oracles"
+	"gopkg.in/yaml.v3"
+)
+
+// Static serves fixed exchange rates. Intended for testing and for operators pricing manually
+type Static struct {
+	rates map[string]decimal.Decimal
+}
+
+var _ oracles.Oracle = (*Static)(nil)
+
+// New creates an oracle with the price of a single XMR for every currency
+func New(rates map[string]decimal.Decimal) (s *Static) {
+	s = &Static{rates: make(map[string]decimal.Decimal, len(rates))}
+	for currency, price := range rates {
+		s.rates[strings.ToUpper(currency)] = price
+	}
+	return s
+}
+
+// Load reads the rates from a YAML file mapping currencies to prices:
+//
+//	EUR: "150.25"
+//	USD: "162.10"
+func Load(filename string) (s *Static, err error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+
+	var rates map[string]decimal.Decimal
+	err = yaml.Unmarshal(contents, &rates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rates: %w", err)
+	}
+	return New(rates), nil
+}
+
+func (s *Static) Rate(ctx context.Context, req oracles.RateRequest) (rate oracles.Rate, err error) {
+	currency := strings.ToUpper(req.Currency)
+	price, found := s.rates[currency]
+	if !found {
+		return rate, fmt.Errorf("%w: %s", oracles.ErrUnsupportedCurrency, req.Currency)
+	}
+
+	rate = oracles.Rate{
+		Currency: currency,
+		Price:    price,
+		Time:     time.Now(),
+	}
+	return rate, nil
+}
@@ -0,0 +1,44 @@
+package static_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RogueTeam/8ball/oracles"
+	"github.com/RogueTeam/8ball/oracles/static"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Static(t *testing.T) {
+	t.Run("Succeed", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		filename := filepath.Join(t.TempDir(), "rates.yaml")
+		err := os.WriteFile(filename, []byte("EUR: \"150.25\"\nusd: \"162.1\"\n"), 0o600)
+		assertions.Nil(err, "failed to write rates file")
+
+		oracle, err := static.Load(filename)
+		assertions.Nil(err, "failed to load rates")
+
+		rate, err := oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "eur"})
+		assertions.Nil(err, "failed to retrieve rate")
+		assertions.Equal("EUR", rate.Currency, "invalid currency")
+		assertions.Equal("150.25", rate.Price.Value.Text('f', 2), "invalid price")
+
+		rate, err = oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "USD"})
+		assertions.Nil(err, "failed to retrieve rate")
+		assertions.Equal("162.10", rate.Price.Value.Text('f', 2), "invalid price")
+	})
+	t.Run("Fail", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		oracle := static.New(nil)
+		_, err := oracle.Rate(context.TODO(), oracles.RateRequest{Currency: "EUR"})
+		assertions.ErrorIs(err, oracles.ErrUnsupportedCurrency, "currency should not be supported")
+
+		_, err = static.Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		assertions.NotNil(err, "missing file should fail")
+	})
+}
@@ -2,8 +2,10 @@ package payments
 
 import (
 	"errors"
+	"log/slog"
 	"time"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/RogueTeam/8ball/wallets"
 	badger "github.com/dgraph-io/badger/v4"
 )
@@ -17,6 +19,7 @@ type Controller struct {
 	timeout     time.Duration
 	beneficiary string
 	wallet      wallets.Wallet
+	logger      *slog.Logger
 }
 
 type Config struct {
@@ -29,6 +32,8 @@ type Config struct {
 	Beneficiary string
 	// Wallets to be used for managing transactions
 	Wallet wallets.Wallet
+	// Structured logger. Defaults to text records on stderr with addresses and transactions redacted
+	Logger *slog.Logger
 }
 
 func New(config Config) (ctrl Controller) {
@@ -36,6 +41,10 @@ func New(config Config) (ctrl Controller) {
 	ctrl.timeout = config.Timeout
 	ctrl.beneficiary = config.Beneficiary
 	ctrl.wallet = config.Wallet
+	ctrl.logger = config.Logger
+	if ctrl.logger == nil {
+		ctrl.logger = logging.New(logging.Config{})
+	}
 
 	return ctrl
 }
@@ -2,15 +2,15 @@ package payments
 
 import (
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/RogueTeam/8ball/utils"
 	"github.com/RogueTeam/8ball/wallets"
 )
 
-func (c *Controller) processPayment(p Payment) (err error) {
+func (c *Controller) processPayment(p Payment, balances balances) (err error) {
 	now := time.Now()
 
 	// cc, _ := json.MarshalIndent(p, "", "\t")
@@ -19,7 +19,7 @@ func (c *Controller) processPayment(p Payment) (err error) {
 	ctx, cancel := utils.NewContext()
 	defer cancel()
 
-	address, err := c.getReceiverAddress(ctx, p.Receiver)
+	address, err := c.getReceiverAddress(ctx, p.Receiver, balances)
 	if err != nil {
 		return fmt.Errorf("failed to get address: %w", err)
 	}
@@ -87,13 +87,28 @@ const MaxConcurrentJobs = 1_000
 
 // Process is a function that goes over all pending payments and checks if the payment was executed
 func (c *Controller) Process() (processed uint64, err error) {
-	payments, errChan := c.streamPendingPayments()
-	defer utils.ConsumeChannel(payments)
-	defer utils.ConsumeChannel(errChan)
+	ctx, cancel := utils.NewContext()
+	defer cancel()
+
+	// Synced once per call. Payments only read the balances of their receivers
+	err = c.wallet.Sync(ctx, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sync wallet: %w", err)
+	}
+
+	payments, err := c.listPendingPayments()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve jobs: %w", err)
+	}
+
+	balances, err := c.receiverBalances(ctx, payments)
+	if err != nil {
+		return 0, err
+	}
 
 	var jobs = utils.NewJobPool(MaxConcurrentJobs)
 	var wg sync.WaitGroup
-	for payment := range payments {
+	for _, payment := range payments {
 		processed++
 		jobs.Get()
 		wg.Add(1)
@@ -101,18 +116,17 @@ func (c *Controller) Process() (processed uint64, err error) {
 			defer wg.Done()
 			defer jobs.Put()
 
-			err := c.processPayment(payment)
+			err := c.processPayment(payment, balances)
 			if err != nil {
-				log.Println("failed to process payment:", payment.Id, err)
+				c.logger.Error("failed to process payment",
+					logging.KeyPayment, payment.Id,
+					logging.KeyReceiver, payment.Receiver.Index,
+					logging.KeyError, err,
+				)
 			}
 		}()
 	}
 
 	wg.Wait()
-
-	err = <-errChan
-	if err != nil {
-		return processed, fmt.Errorf("failed to retrieve jobs: %w", err)
-	}
 	return processed, nil
 }
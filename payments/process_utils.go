@@ -2,12 +2,21 @@ package payments
 
 import (
 	"fmt"
-	"log"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 )
 
+// Collects the pending payments so their receivers can be read in a single batch
+func (c *Controller) listPendingPayments() (payments []Payment, err error) {
+	stream, errChan := c.streamPendingPayments()
+	for payment := range stream {
+		payments = append(payments, payment)
+	}
+	return payments, <-errChan
+}
+
 // Streams pending payments into a channel. Its intended be used in parallel while querying wallets
 // payments channel should must be consumed at all
 func (c *Controller) streamPendingPayments() (payments chan Payment, err chan error) {
@@ -35,14 +44,14 @@ func (c *Controller) streamPendingPayments() (payments chan Payment, err chan er
 				})
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment id: %w", err)
-					log.Println(err) // We can't return but even then we need to try the others
+					c.logger.Error("failed to stream payment", logging.KeyError, err) // We can't return but even then we need to try the others
 					continue
 				}
 
 				paymentItem, err := txn.Get(PaymentKey(id))
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment: %w", err)
-					log.Println(err)
+					c.logger.Error("failed to stream payment", logging.KeyError, err)
 					continue
 				}
 
@@ -55,7 +64,7 @@ func (c *Controller) streamPendingPayments() (payments chan Payment, err chan er
 				})
 				if err != nil {
 					err = fmt.Errorf("failed to retrieve payment: %w", err)
-					log.Println(err) // We can't return but even then we need to try the others
+					c.logger.Error("failed to stream payment", logging.KeyError, err) // We can't return but even then we need to try the others
 					continue
 				}
 
@@ -2,28 +2,49 @@ package payments
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
+	"github.com/RogueTeam/8ball/logging"
 	"github.com/RogueTeam/8ball/wallets"
 	badger "github.com/dgraph-io/badger/v4"
 )
 
-func (c *Controller) getReceiverAddress(ctx context.Context, r Receiver) (address wallets.Address, err error) {
-	log.Println("Querying address:", r.Index)
+// Balances of the receivers read in a single batch by Process
+type balances map[uint64]wallets.Address
 
-	err = c.wallet.Sync(ctx, true)
-	if err != nil {
-		return address, fmt.Errorf("failed to sync wallet: %w", err)
+func (c *Controller) receiverBalances(ctx context.Context, payments []Payment) (b balances, err error) {
+	indices := make([]uint64, 0, len(payments))
+	for _, p := range payments {
+		indices = append(indices, p.Receiver.Index)
 	}
 
-	address, err = c.wallet.Address(ctx, wallets.AddressRequest{Index: r.Index})
+	addresses, err := wallets.Addresses(ctx, c.wallet, wallets.AddressesRequest{Indices: indices})
 	if err != nil {
-		return address, fmt.Errorf("failed to retrieve address: %w", err)
+		return nil, fmt.Errorf("failed to retrieve receiver balances: %w", err)
+	}
+
+	b = make(balances, len(addresses))
+	for _, address := range addresses {
+		b[address.Index] = address
+	}
+	return b, nil
+}
+
+// Returns the receiver from the balances read by Process. Receivers missing from them are queried
+func (c *Controller) getReceiverAddress(ctx context.Context, r Receiver, balances balances) (address wallets.Address, err error) {
+	address, found := balances[r.Index]
+	if !found {
+		c.logger.Debug("querying address", logging.KeyReceiver, r.Index)
+
+		address, err = c.wallet.Address(ctx, wallets.AddressRequest{Index: r.Index})
+		if err != nil {
+			return address, fmt.Errorf("failed to retrieve address: %w", err)
+		}
 	}
 
 	if address.Address != r.Address {
-		return address, fmt.Errorf("expecting a different address: %s != %s; did server wallet changed?", r.Address, address.Address)
+		return address, errors.New("expecting a different address; did server wallet changed?")
 	}
 	return address, nil
 }
@@ -46,7 +67,7 @@ func (c *Controller) savePaymentState(p Payment) (err error) {
 
 // This is a utility function that should be called just in case something goes wrong while processing a pending payment
 func (c *Controller) deletePendingPayment(p Payment) (err error) {
-	log.Println("Deleting pending entry")
+	c.logger.Debug("deleting pending entry", logging.KeyPayment, p.Id)
 	return c.db.Update(func(txn *badger.Txn) (err error) {
 		err = txn.Delete(PendingKey(p.Id))
 		if err != nil {
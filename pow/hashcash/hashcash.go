@@ -17,6 +17,9 @@ import (
 
 var countLeadingBitsCbytes = []int{8, 4, 2, 1}
 
+// Layout of the date embedded in the hashcash (YYMMDDhhmmss in UTC)
+const DateFormat = "060102150405"
+
 func CountLeadingBits(s []byte) (n int) {
 	src := bytes.NewReader(s)
 
@@ -66,7 +69,7 @@ func CountLeadingBits(s []byte) (n int) {
 // Creates a hashcash (hc)
 // hash is reset on every try
 func New(ctx context.Context, h hash.Hash, bits int, salt, payload string) (hc string, err error) {
-	now := time.Now()
+	now := time.Now().UTC()
 
 	for counter := big.NewInt(0); ; counter = counter.Add(counter, big.NewInt(1)) {
 		select {
@@ -75,7 +78,7 @@ func New(ctx context.Context, h hash.Hash, bits int, salt, payload string) (hc s
 		default:
 			h.Reset()
 
-			hc = fmt.Sprintf("1:%d:%s::%s:%s:%s", bits, now.Format("240615143059"), payload, salt, base64.StdEncoding.EncodeToString(counter.Bytes()))
+			hc = fmt.Sprintf("1:%d:%s::%s:%s:%s", bits, now.Format(DateFormat), payload, salt, base64.StdEncoding.EncodeToString(counter.Bytes()))
 
 			h.Write([]byte(hc))
 
@@ -86,25 +89,57 @@ func New(ctx context.Context, h hash.Hash, bits int, salt, payload string) (hc s
 	}
 }
 
-// Verifies a hashcash is valid. Returns nil on valid
-// And error if the hash is invalid
-func Verify(h hash.Hash, hc string) (err error) {
+// Fields of a hashcash
+type Stamp struct {
+	// Bits claimed by the hashcash
+	Bits uint64
+	// Moment the hashcash was created
+	Date time.Time
+	// Payload the hashcash was created for
+	Payload string
+	// Salt used during the creation
+	Salt string
+	// Encoded counter that satisfies the bits
+	Counter string
+}
+
+// Parses the fields of a hashcash without verifying it
+func Parse(hc string) (stamp Stamp, err error) {
 	var parts = strings.Split(hc, ":")
 	if len(parts) != 7 {
-		return errors.New("invalid hashcash")
+		return stamp, errors.New("invalid hashcash")
+	}
+
+	stamp.Bits, err = strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return stamp, fmt.Errorf("failed to parse bits part: %w", err)
 	}
 
-	bits, err := strconv.ParseUint(parts[1], 10, 64)
+	stamp.Date, err = time.Parse(DateFormat, parts[2])
+	if err != nil {
+		return stamp, fmt.Errorf("failed to parse date part: %w", err)
+	}
+
+	stamp.Payload = parts[4]
+	stamp.Salt = parts[5]
+	stamp.Counter = parts[6]
+	return stamp, nil
+}
+
+// Verifies a hashcash is valid. Returns nil on valid
+// And error if the hash is invalid
+func Verify(h hash.Hash, hc string) (err error) {
+	stamp, err := Parse(hc)
 	if err != nil {
-		return fmt.Errorf("failed to parse bits part: %w", err)
+		return err
 	}
 
 	h.Reset()
 	h.Write([]byte(hc))
 
 	cBits := uint64(CountLeadingBits(h.Sum(nil)))
-	if bits != cBits {
-		return fmt.Errorf("expecting %d bits but got %d", bits, cBits)
+	if stamp.Bits != cBits {
+		return fmt.Errorf("expecting %d bits but got %d", stamp.Bits, cBits)
 	}
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"hash"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/RogueTeam/8ball/pow/hashcash"
 	"github.com/RogueTeam/8ball/utils"
@@ -202,3 +203,40 @@ func Test_Integration(t *testing.T) {
 		}
 	})
 }
+
+func Test_Parse(t *testing.T) {
+	t.Run("Succeed", func(t *testing.T) {
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		before := time.Now().UTC().Truncate(time.Second)
+		hc, err := hashcash.New(ctx, sha256.New(), 8, "salt", "payments")
+		assertions.Nil(err, "failed to hashcash")
+
+		stamp, err := hashcash.Parse(hc)
+		assertions.Nil(err, "failed to parse hashcash")
+		assertions.Equal(uint64(8), stamp.Bits, "invalid bits")
+		assertions.Equal("salt", stamp.Salt, "invalid salt")
+		assertions.Equal("payments", stamp.Payload, "invalid payload")
+		assertions.False(stamp.Date.Before(before), "date should not be before creation")
+		assertions.WithinDuration(time.Now(), stamp.Date, time.Minute, "date should be close to creation")
+	})
+	t.Run("Fail", func(t *testing.T) {
+		tests := []string{
+			"",
+			"1:8:250101000000::payments:salt",
+			"1:bits:250101000000::payments:salt:AA==",
+			"1:8:date::payments:salt:AA==",
+		}
+		for _, hc := range tests {
+			t.Run(hc, func(t *testing.T) {
+				assertions := assert.New(t)
+
+				_, err := hashcash.Parse(hc)
+				assertions.NotNil(err, "expecting error")
+			})
+		}
+	})
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "time"
+
+// Exponential backoff for the passed attempt number (starting at 1)
+// The result is doubled on every attempt and never exceeds max
+func Backoff(base, max time.Duration, attempt uint64) (delay time.Duration) {
+	delay = base
+	for range attempt - min(attempt, 1) {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+	return min(delay, max)
+}
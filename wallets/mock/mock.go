@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,6 +18,12 @@ var (
 	ErrTransactionNotFound = errors.New("transaction not found")
 )
 
+type incomingTransfer struct {
+	transactionId string
+	amount        uint64
+	received      time.Time
+}
+
 type Transaction struct {
 	Status   wallets.TransactionStatus
 	Sweep    *wallets.Sweep
@@ -29,11 +36,23 @@ type Mock struct {
 	addresses      map[uint64]wallets.Address // index -> Account
 	nextIndex      uint64
 	transactions   map[string]Transaction // txHash -> transaction details (for tracking)
+	incoming       map[uint64][]incomingTransfer
+	outgoing       map[uint64][]wallets.OutgoingTransfer
 	fundsDelta     time.Duration
 	zeroOnTransfer bool
+	subscribers    map[chan wallets.Event]struct{}
+	unsigned       map[string]func(ctx context.Context) (transactionId string, err error)
+	prepared       uint64
 }
 
-var _ wallets.Wallet = (*Mock)(nil)
+var (
+	_ wallets.Wallet          = (*Mock)(nil)
+	_ wallets.MultiTransferer = (*Mock)(nil)
+	_ wallets.BatchAddresser  = (*Mock)(nil)
+	_ wallets.Notifier        = (*Mock)(nil)
+
+	_ wallets.BatchIncomingTransferer = (*Mock)(nil)
+)
 
 type Config struct {
 	FundsDelta     time.Duration
@@ -46,7 +65,11 @@ func New(config Config) *Mock {
 		addresses:    make(map[uint64]wallets.Address),
 		nextIndex:    0, // Start nextIndex at 0
 		transactions: make(map[string]Transaction),
+		incoming:     make(map[uint64][]incomingTransfer),
+		outgoing:     make(map[uint64][]wallets.OutgoingTransfer),
 		fundsDelta:   config.FundsDelta,
+		subscribers:  make(map[chan wallets.Event]struct{}),
+		unsigned:     make(map[string]func(ctx context.Context) (transactionId string, err error)),
 	}
 
 	// Initialize with a zero-index account
@@ -122,29 +145,14 @@ func (m *Mock) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep wa
 		Fee:         appliedFee,
 	}
 	m.transactions[mockTxHash] = Transaction{Status: wallets.TransactionStatusPending, Sweep: &sweep} // Track the transaction
+	m.send(req.SourceIndex, mockTxHash, appliedFee, wallets.Destination{Address: req.Destination, Amount: transferredAmount})
 
 	for index, account := range m.addresses {
 		if account.Address != req.Destination {
 			continue
 		}
 
-		account.Balance += transferredAmount
-		m.addresses[index] = account
-
-		go func() {
-			time.Sleep(m.fundsDelta)
-
-			m.mu.Lock()
-			defer m.mu.Unlock()
-
-			tx := m.transactions[mockTxHash]
-			tx.Status = wallets.TransactionStatusCompleted
-			m.transactions[mockTxHash] = tx
-
-			account := m.addresses[index]
-			account.UnlockedBalance = account.Balance
-			m.addresses[index] = account
-		}()
+		m.receive(index, mockTxHash, transferredAmount)
 		break
 	}
 	return sweep, nil
@@ -200,30 +208,84 @@ func (m *Mock) Transfer(ctx context.Context, req wallets.TransferRequest) (trans
 		Fee:         DefaultFee,
 	}
 	m.transactions[mockTxHash] = Transaction{Status: wallets.TransactionStatusPending, Transfer: &transfer} // Track the transaction
+	m.send(req.SourceIndex, mockTxHash, DefaultFee, wallets.Destination{Address: req.Destination, Amount: req.Amount})
 
 	for index, account := range m.addresses {
 		if account.Address != req.Destination {
 			continue
 		}
 
-		account.Balance += req.Amount
-		m.addresses[index] = account
+		m.receive(index, mockTxHash, req.Amount)
+		break
+	}
+	return transfer, nil
+}
 
-		go func() {
-			time.Sleep(m.fundsDelta)
+// TransferMany pays every destination in a single mock transaction
+func (m *Mock) TransferMany(ctx context.Context, req wallets.TransferManyRequest) (transfer wallets.TransferMany, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-			m.mu.Lock()
-			defer m.mu.Unlock()
+	err = req.Validate()
+	if err != nil {
+		return transfer, err
+	}
+
+	sourceAccount, ok := m.addresses[req.SourceIndex]
+	if !ok {
+		return transfer, ErrAddressNotFound
+	}
 
-			tx := m.transactions[mockTxHash]
-			tx.Status = wallets.TransactionStatusCompleted
-			m.transactions[mockTxHash] = tx
+	var total uint64
+	for _, destination := range req.Destinations {
+		if destination.Amount == 0 {
+			return transfer, ErrInvalidAmount
+		}
+		total += destination.Amount
+	}
+	if sourceAccount.UnlockedBalance < total {
+		return transfer, ErrInsufficientBalance
+	}
 
-			account := m.addresses[index]
-			account.UnlockedBalance = account.Balance
-			m.addresses[index] = account
-		}()
-		break
+	destinations := slices.Clone(req.Destinations)
+	if destinations[req.SubtractFeeFrom].Amount <= DefaultFee {
+		return transfer, wallets.ErrFeeExceedsAmount
+	}
+	destinations[req.SubtractFeeFrom].Amount -= DefaultFee
+
+	sourceAccount.Balance -= total
+	sourceAccount.UnlockedBalance = sourceAccount.Balance
+	m.addresses[req.SourceIndex] = sourceAccount
+
+	mockTxHash := fmt.Sprintf("mock_transfer_many_tx_%d_%d", req.SourceIndex, len(m.transactions))
+
+	transfer = wallets.TransferMany{
+		Address:      mockTxHash,
+		SourceIndex:  req.SourceIndex,
+		Destinations: destinations,
+		Fee:          DefaultFee,
+	}
+	m.transactions[mockTxHash] = Transaction{
+		Status: wallets.TransactionStatusPending,
+		Transfer: &wallets.Transfer{
+			Address:     mockTxHash,
+			SourceIndex: req.SourceIndex,
+			Destination: destinations[0].Address,
+			Amount:      destinations[0].Amount,
+			Fee:         DefaultFee,
+		},
+	}
+	m.send(req.SourceIndex, mockTxHash, DefaultFee, destinations...)
+
+	for _, destination := range destinations {
+		for index, account := range m.addresses {
+			if account.Address != destination.Address {
+				continue
+			}
+
+			m.receive(index, mockTxHash, destination.Amount)
+			break
+		}
 	}
 	return transfer, nil
 }
@@ -240,6 +302,22 @@ func (m *Mock) Address(ctx context.Context, req wallets.AddressRequest) (address
 	return acc, nil
 }
 
+// Addresses returns the balances of the specified accounts.
+func (m *Mock) Addresses(ctx context.Context, req wallets.AddressesRequest) (addresses []wallets.Address, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addresses = make([]wallets.Address, 0, len(req.Indices))
+	for _, index := range req.Indices {
+		acc, ok := m.addresses[index]
+		if !ok {
+			return nil, ErrAddressNotFound
+		}
+		addresses = append(addresses, acc)
+	}
+	return addresses, nil
+}
+
 // ValidateAddress always returns true for any address in the mock.
 func (m *Mock) ValidateAddress(ctx context.Context, req wallets.ValidateAddressRequest) (err error) {
 	// For testing, all addresses are valid.
@@ -247,6 +325,9 @@ func (m *Mock) ValidateAddress(ctx context.Context, req wallets.ValidateAddressR
 }
 
 func (m *Mock) Transaction(ctx context.Context, req wallets.TransactionRequest) (tx wallets.Transaction, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	transaction, found := m.transactions[req.TransactionId]
 	if !found {
 		return tx, ErrTransactionNotFound
@@ -269,3 +350,162 @@ func (m *Mock) Transaction(ctx context.Context, req wallets.TransactionRequest)
 
 	return tx, nil
 }
+
+// OutgoingTransfers lists the mock transactions sent from the address
+func (m *Mock) OutgoingTransfers(ctx context.Context, req wallets.OutgoingTransfersRequest) (transfers []wallets.OutgoingTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.addresses[req.Index]; !ok {
+		return nil, ErrAddressNotFound
+	}
+	return slices.Clone(m.outgoing[req.Index]), nil
+}
+
+// Records a transaction sent from the address
+func (m *Mock) send(index uint64, transactionId string, fee uint64, destinations ...wallets.Destination) {
+	m.outgoing[index] = append(m.outgoing[index], wallets.OutgoingTransfer{
+		TransactionId: transactionId,
+		SourceIndex:   index,
+		Destinations:  slices.Clone(destinations),
+		Fee:           fee,
+		Timestamp:     time.Now(),
+	})
+}
+
+// Confirmations reached by a transfer by the time its funds unlock
+const UnlockConfirmations = 10
+
+// Credits the destination simulating the pool, the first confirmation and the unlock of the funds.
+// Funds remain out of the balance while in the pool
+func (m *Mock) receive(index uint64, transactionId string, amount uint64) {
+	m.incoming[index] = append(m.incoming[index], incomingTransfer{
+		transactionId: transactionId,
+		amount:        amount,
+		received:      time.Now(),
+	})
+
+	event := wallets.Event{
+		Type:          wallets.EventIncoming,
+		Index:         index,
+		TransactionId: transactionId,
+		Amount:        amount,
+	}
+	m.notify(event)
+
+	credit := func() {
+		account := m.addresses[index]
+		account.Balance += amount
+		m.addresses[index] = account
+
+		event.Type = wallets.EventConfirmed
+		m.notify(event)
+	}
+	if m.fundsDelta == 0 {
+		credit()
+	} else {
+		go func() {
+			time.Sleep(m.fundsDelta / UnlockConfirmations)
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+
+			credit()
+		}()
+	}
+
+	go func() {
+		time.Sleep(m.fundsDelta)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		tx := m.transactions[transactionId]
+		tx.Status = wallets.TransactionStatusCompleted
+		m.transactions[transactionId] = tx
+
+		account := m.addresses[index]
+		account.UnlockedBalance = account.Balance
+		m.addresses[index] = account
+	}()
+}
+
+// Subscribe emits an incoming event when a transfer is sent and a confirmed event once its
+// first block is simulated
+func (m *Mock) Subscribe(ctx context.Context) (events <-chan wallets.Event, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subscriber := make(chan wallets.Event, 100)
+	m.subscribers[subscriber] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		delete(m.subscribers, subscriber)
+		close(subscriber)
+	}()
+	return subscriber, nil
+}
+
+// Sends the event to the subscribers without blocking. Must be called holding the lock
+func (m *Mock) notify(event wallets.Event) {
+	for subscriber := range m.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// IncomingTransfers simulates a block every FundsDelta / UnlockConfirmations
+func (m *Mock) IncomingTransfers(ctx context.Context, req wallets.IncomingTransfersRequest) (transfers []wallets.IncomingTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.addresses[req.Index]; !ok {
+		return nil, ErrAddressNotFound
+	}
+	return m.incomingTransfers(req.Index, req.Pool), nil
+}
+
+func (m *Mock) IncomingTransfersBatch(ctx context.Context, req wallets.IncomingTransfersBatchRequest) (transfers map[uint64][]wallets.IncomingTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transfers = make(map[uint64][]wallets.IncomingTransfer, len(req.Indices))
+	for _, index := range req.Indices {
+		if _, ok := m.addresses[index]; !ok {
+			return nil, ErrAddressNotFound
+		}
+		if incoming := m.incomingTransfers(index, req.Pool); len(incoming) > 0 {
+			transfers[index] = incoming
+		}
+	}
+	return transfers, nil
+}
+
+// Lists the transfers received by the address. Must be called holding the lock
+func (m *Mock) incomingTransfers(index uint64, pool bool) (transfers []wallets.IncomingTransfer) {
+	for _, incoming := range m.incoming[index] {
+		var confirmations uint64 = UnlockConfirmations
+		if m.fundsDelta > 0 {
+			confirmations = uint64(time.Since(incoming.received) * UnlockConfirmations / m.fundsDelta)
+		}
+
+		inPool := confirmations == 0
+		if inPool && !pool {
+			continue
+		}
+		transfers = append(transfers, wallets.IncomingTransfer{
+			TransactionId: incoming.transactionId,
+			Amount:        incoming.amount,
+			Confirmations: confirmations,
+			InPool:        inPool,
+		})
+	}
+	return transfers
+}
@@ -0,0 +1,140 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+var (
+	ErrUnsignedNotFound = fmt.Errorf("%w: unsigned transfer not found", wallets.ErrPermanent)
+	ErrNotSigned        = fmt.Errorf("%w: transfer not signed", wallets.ErrPermanent)
+)
+
+// Prefix added by Sign to the transaction sets
+const signedPrefix = "signed_"
+
+var _ wallets.ViewOnly = (*Mock)(nil)
+
+// Keeps the transfer until its signed transaction set is submitted
+func (m *Mock) prepare(unsigned *wallets.UnsignedTransfer, transfer func(ctx context.Context) (transactionId string, err error)) {
+	unsigned.Txset = fmt.Sprintf("mock_unsigned_%d_%d", unsigned.SourceIndex, m.prepared)
+	m.unsigned[unsigned.Txset] = transfer
+	m.prepared++
+}
+
+// PrepareTransfer reports the amounts of Transfer. Funds are only checked once submitted
+func (m *Mock) PrepareTransfer(ctx context.Context, req wallets.TransferRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.addresses[req.SourceIndex]; !ok {
+		return unsigned, ErrAddressNotFound
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		SourceIndex:  req.SourceIndex,
+		Destinations: []wallets.Destination{{Address: req.Destination, Amount: req.Amount}},
+		Fee:          DefaultFee,
+	}
+	m.prepare(&unsigned, func(ctx context.Context) (transactionId string, err error) {
+		transfer, err := m.Transfer(ctx, req)
+		return transfer.Address, err
+	})
+	return unsigned, nil
+}
+
+// PrepareSweep reports the amounts of SweepAll. Funds are only checked once submitted
+func (m *Mock) PrepareSweep(ctx context.Context, req wallets.SweepRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, ok := m.addresses[req.SourceIndex]
+	if !ok {
+		return unsigned, ErrAddressNotFound
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		SourceIndex:  req.SourceIndex,
+		Destinations: []wallets.Destination{{Address: req.Destination, Amount: source.UnlockedBalance}},
+	}
+	m.prepare(&unsigned, func(ctx context.Context) (transactionId string, err error) {
+		sweep, err := m.SweepAll(ctx, req)
+		return sweep.Address, err
+	})
+	return unsigned, nil
+}
+
+// PrepareTransferMany reports the amounts of TransferMany. Funds are only checked once submitted
+func (m *Mock) PrepareTransferMany(ctx context.Context, req wallets.TransferManyRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = req.Validate()
+	if err != nil {
+		return unsigned, err
+	}
+	if _, ok := m.addresses[req.SourceIndex]; !ok {
+		return unsigned, ErrAddressNotFound
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		SourceIndex:  req.SourceIndex,
+		Destinations: append([]wallets.Destination(nil), req.Destinations...),
+		Fee:          DefaultFee,
+	}
+	payer := &unsigned.Destinations[req.SubtractFeeFrom]
+	if payer.Amount <= DefaultFee {
+		return unsigned, wallets.ErrFeeExceedsAmount
+	}
+	payer.Amount -= DefaultFee
+
+	m.prepare(&unsigned, func(ctx context.Context) (transactionId string, err error) {
+		transfer, err := m.TransferMany(ctx, req)
+		return transfer.Address, err
+	})
+	return unsigned, nil
+}
+
+// Sign simulates the offline wallet signing a prepared transaction set
+func (m *Mock) Sign(txset string) (signed string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.unsigned[txset]; !ok {
+		return "", ErrUnsignedNotFound
+	}
+	return signedPrefix + txset, nil
+}
+
+// Submit makes the prepared transfer
+func (m *Mock) Submit(ctx context.Context, req wallets.SubmitRequest) (transactionIds []string, err error) {
+	txset, signed := strings.CutPrefix(req.Txset, signedPrefix)
+	if !signed {
+		return nil, ErrNotSigned
+	}
+
+	m.mu.Lock()
+	transfer, ok := m.unsigned[txset]
+	delete(m.unsigned, txset)
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrUnsignedNotFound
+	}
+
+	transactionId, err := transfer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []string{transactionId}, nil
+}
+
+func (m *Mock) ExportOutputs(ctx context.Context) (outputs string, err error) {
+	return "mock_outputs", nil
+}
+
+func (m *Mock) ImportKeyImages(ctx context.Context, req wallets.ImportKeyImagesRequest) (err error) {
+	return nil
+}
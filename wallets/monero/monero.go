@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/RogueTeam/8ball/internal/walletrpc/old_rpc"
 	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
 	"github.com/RogueTeam/8ball/utils"
 	wallets "github.com/RogueTeam/8ball/wallets"
@@ -16,42 +18,73 @@ const MoneroUnit = 1_000_000_000_000
 type Config struct {
 	Accounts bool
 	Client   *rpc.Client
+	// Optional daemon client. When set pool transfers are verified against the daemon's pool
+	Daemon *old_rpc.Client
+	// Interval between the polls of the subscriptions. Defaults to DefaultNotifyInterval
+	NotifyInterval time.Duration
 }
 
 type Wallet struct {
 	mutex    *sync.Mutex
 	accounts bool
 	client   *rpc.Client
+	daemon   *old_rpc.Client
+	// Interval between the polls of the subscriptions
+	notifyInterval time.Duration
+	// Height reached by the last sync. Incremental syncs start from it
+	height uint64
 }
 
 var (
 	ErrAddressNotFound  = errors.New("address not found")
 	ErrInvalidAddrIndex = errors.New("invalid address index")
-	ErrInvalidAddress   = errors.New("invalid address")
+	ErrInvalidAddress   = wallets.ErrInvalidAddress
 )
 
-var _ wallets.Wallet = (*Wallet)(nil)
+var (
+	_ wallets.Wallet          = (*Wallet)(nil)
+	_ wallets.MultiTransferer = (*Wallet)(nil)
+	_ wallets.BatchAddresser  = (*Wallet)(nil)
+	_ wallets.Notifier        = (*Wallet)(nil)
+
+	_ wallets.BatchIncomingTransferer = (*Wallet)(nil)
+)
 
+// Sync refreshes the wallet. Full syncs scan the chain from the first block, rescan the spent
+// outputs and store the wallet. Otherwise only the blocks since the last sync are fetched
 func (w *Wallet) Sync(ctx context.Context, full bool) (err error) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	_, err = w.client.Refresh(ctx, &rpc.RefreshRequest{StartHeight: 1})
+	full = full || w.height == 0
+
+	var startHeight uint64 = 1
+	if !full {
+		startHeight = w.height
+	}
+	_, err = w.client.Refresh(ctx, &rpc.RefreshRequest{StartHeight: startHeight})
 	if err != nil {
 		return fmt.Errorf("failed to refresh wallet: %w", err)
 	}
 
-	err = w.client.RescanSpent(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to rescan for spent outputs: %w", err)
+	if full {
+		err = w.client.RescanSpent(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to rescan for spent outputs: %w", err)
+		}
+
+		err = w.client.Store(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to save changes: %w", err)
+		}
 	}
 
-	err = w.client.Store(ctx)
+	height, err := w.client.GetHeight(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to save changes: %w", err)
+		return fmt.Errorf("failed to retrieve wallet height: %w", err)
 	}
-
-	return
+	w.height = height.Height
+	return nil
 }
 
 func (w *Wallet) NewAddress(ctx context.Context, req wallets.NewAddressRequest) (address wallets.Address, err error) {
@@ -107,17 +140,43 @@ func (w *Wallet) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	trans, err := w.sweepRequest(ctx, req)
+	if err != nil {
+		return sweep, err
+	}
+
+	res, err := w.client.SweepAll(ctx, &trans)
+	if err != nil {
+		return sweep, fmt.Errorf("failed to transfer monero: %w", classify(err))
+	}
+
+	err = w.client.Store(ctx)
+	if err != nil {
+		return sweep, fmt.Errorf("failed to save changes: %w", err)
+	}
+
+	sweep = wallets.Sweep{
+		Address:     res.TxHashList[0],
+		SourceIndex: req.SourceIndex,
+		Destination: req.Destination,
+		Amount:      utils.MapInt[int, uint64](res.AmountList)[0],
+		Fee:         utils.MapInt[int, uint64](res.FeeList)[0],
+	}
+
+	return
+}
+
+func (w *Wallet) sweepRequest(ctx context.Context, req wallets.SweepRequest) (trans rpc.SweepAllRequest, err error) {
 	err = w.validateAddress(ctx, req.Destination)
 	if err != nil {
-		return sweep, fmt.Errorf("failed to validate destination address: %w", err)
+		return trans, fmt.Errorf("failed to validate destination address: %w", err)
 	}
 
 	priority, err := convertPriority(req.Priority)
 	if err != nil {
-		return sweep, fmt.Errorf("failed to convert priority: %w", err)
+		return trans, fmt.Errorf("failed to convert priority: %w", err)
 	}
 
-	var trans rpc.SweepAllRequest
 	if w.accounts {
 		trans = rpc.SweepAllRequest{
 			Address:           req.Destination,
@@ -147,42 +206,49 @@ func (w *Wallet) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep
 			GetTxMetadata:  true,
 		}
 	}
+	return trans, nil
+}
 
-	res, err := w.client.SweepAll(ctx, &trans)
+func (w *Wallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	trans, err := w.transferRequest(ctx, req)
 	if err != nil {
-		return sweep, fmt.Errorf("failed to transfer monero: %w", err)
+		return transfer, err
+	}
+
+	res, err := w.client.Transfer(ctx, &trans)
+	if err != nil {
+		return transfer, fmt.Errorf("failed to transfer monero: %w", classify(err))
 	}
 
 	err = w.client.Store(ctx)
 	if err != nil {
-		return sweep, fmt.Errorf("failed to save changes: %w", err)
+		return transfer, fmt.Errorf("failed to save changes: %w", err)
 	}
 
-	sweep = wallets.Sweep{
-		Address:     res.TxHashList[0],
+	transfer = wallets.Transfer{
+		Address:     res.TxHash,
 		SourceIndex: req.SourceIndex,
 		Destination: req.Destination,
-		Amount:      utils.MapInt[int, uint64](res.AmountList)[0],
-		Fee:         utils.MapInt[int, uint64](res.FeeList)[0],
+		Amount:      res.Amount,
+		Fee:         res.Fee,
 	}
 
-	return
+	return transfer, nil
 }
 
-func (w *Wallet) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
-	w.mutex.Lock()
-	defer w.mutex.Unlock()
-
+func (w *Wallet) transferRequest(ctx context.Context, req wallets.TransferRequest) (trans rpc.TransferRequest, err error) {
 	err = w.validateAddress(ctx, req.Destination)
 	if err != nil {
-		return transfer, fmt.Errorf("failed to validate destination address: %w: %s", err, req.Destination)
+		return trans, fmt.Errorf("failed to validate destination address: %w: %s", err, req.Destination)
 	}
 
 	priority, err := convertPriority(req.Priority)
 	if err != nil {
-		return transfer, fmt.Errorf("failed to convert priority: %w", err)
+		return trans, fmt.Errorf("failed to convert priority: %w", err)
 	}
-	var trans rpc.TransferRequest
 	if w.accounts {
 		trans = rpc.TransferRequest{
 			Destinations: []rpc.Destination{
@@ -211,10 +277,21 @@ func (w *Wallet) Transfer(ctx context.Context, req wallets.TransferRequest) (tra
 			GetTxMetadata:  true,
 		}
 	}
+	return trans, nil
+}
+
+func (w *Wallet) TransferMany(ctx context.Context, req wallets.TransferManyRequest) (transfer wallets.TransferMany, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	trans, err := w.transferManyRequest(ctx, req)
+	if err != nil {
+		return transfer, err
+	}
 
 	res, err := w.client.Transfer(ctx, &trans)
 	if err != nil {
-		return transfer, fmt.Errorf("failed to transfer monero: %w", err)
+		return transfer, fmt.Errorf("failed to transfer monero: %w", classify(err))
 	}
 
 	err = w.client.Store(ctx)
@@ -222,17 +299,72 @@ func (w *Wallet) Transfer(ctx context.Context, req wallets.TransferRequest) (tra
 		return transfer, fmt.Errorf("failed to save changes: %w", err)
 	}
 
-	transfer = wallets.Transfer{
+	transfer = wallets.TransferMany{
 		Address:     res.TxHash,
 		SourceIndex: req.SourceIndex,
-		Destination: req.Destination,
-		Amount:      res.Amount,
 		Fee:         res.Fee,
 	}
-
+	for _, destination := range trans.Destinations {
+		transfer.Destinations = append(transfer.Destinations, wallets.Destination{Address: destination.Address, Amount: destination.Amount})
+	}
 	return transfer, nil
 }
 
+// Request paying the destinations with the network fee already discounted
+func (w *Wallet) transferManyRequest(ctx context.Context, req wallets.TransferManyRequest) (trans rpc.TransferRequest, err error) {
+	err = req.Validate()
+	if err != nil {
+		return trans, err
+	}
+
+	for _, destination := range req.Destinations {
+		err = w.validateAddress(ctx, destination.Address)
+		if err != nil {
+			return trans, fmt.Errorf("failed to validate destination address: %w: %s", err, destination.Address)
+		}
+	}
+
+	priority, err := convertPriority(req.Priority)
+	if err != nil {
+		return trans, fmt.Errorf("failed to convert priority: %w", err)
+	}
+
+	trans = rpc.TransferRequest{
+		AccountIndex:  0,
+		Priority:      priority,
+		RingSize:      16, // Fixed by the network. May require update in the future
+		UnlockTime:    req.UnlockTime,
+		GetTxKey:      true,
+		GetTxHex:      true,
+		GetTxMetadata: true,
+	}
+	if w.accounts {
+		trans.AccountIndex = req.SourceIndex
+	} else {
+		trans.SubaddrIndices = []uint64{req.SourceIndex}
+	}
+	for _, destination := range req.Destinations {
+		trans.Destinations = append(trans.Destinations, rpc.Destination{Amount: destination.Amount, Address: destination.Address})
+	}
+
+	// The network fee depends on the weight of the transaction, not on the amounts.
+	// A transaction that is never relayed gives the exact fee to discount
+	trans.DoNotRelay = true
+	estimate, err := w.client.Transfer(ctx, &trans)
+	if err != nil {
+		return trans, fmt.Errorf("failed to estimate network fee: %w", classify(err))
+	}
+
+	payer := &trans.Destinations[req.SubtractFeeFrom]
+	if payer.Amount <= estimate.Fee {
+		return trans, fmt.Errorf("%w: %d <= %d", wallets.ErrFeeExceedsAmount, payer.Amount, estimate.Fee)
+	}
+	payer.Amount -= estimate.Fee
+
+	trans.DoNotRelay = false
+	return trans, nil
+}
+
 func (w *Wallet) Address(ctx context.Context, req wallets.AddressRequest) (address wallets.Address, err error) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -284,6 +416,70 @@ func (w *Wallet) Address(ctx context.Context, req wallets.AddressRequest) (addre
 	return address, nil
 }
 
+// Addresses retrieves the balances of every requested address in a single call
+func (w *Wallet) Addresses(ctx context.Context, req wallets.AddressesRequest) (addresses []wallets.Address, err error) {
+	if len(req.Indices) == 0 {
+		return nil, nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.accounts {
+		return w.accountAddresses(ctx, req)
+	}
+
+	balance, err := w.client.GetBalance(ctx, &rpc.GetBalanceRequest{
+		AccountIndex:   0,
+		AddressIndices: req.Indices,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	subaddresses := make(map[uint64]rpc.Address, len(balance.PerSubaddress))
+	for _, subBalance := range balance.PerSubaddress {
+		subaddresses[subBalance.AddressIndex] = subBalance
+	}
+
+	addresses = make([]wallets.Address, 0, len(req.Indices))
+	for _, index := range req.Indices {
+		subBalance := subaddresses[index]
+		addresses = append(addresses, wallets.Address{
+			Address:         subBalance.Address,
+			Index:           index,
+			Balance:         subBalance.Balance,
+			UnlockedBalance: subBalance.UnlockedBalance,
+		})
+	}
+	return addresses, nil
+}
+
+// Every account is listed by get_accounts. Only the requested ones are returned
+func (w *Wallet) accountAddresses(ctx context.Context, req wallets.AddressesRequest) (addresses []wallets.Address, err error) {
+	res, err := w.client.GetAccounts(ctx, &rpc.GetAccountsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts: %w", err)
+	}
+
+	accounts := make(map[uint64]rpc.Account, len(res.SubaddressAccounts))
+	for _, account := range res.SubaddressAccounts {
+		accounts[account.AccountIndex] = account
+	}
+
+	addresses = make([]wallets.Address, 0, len(req.Indices))
+	for _, index := range req.Indices {
+		account := accounts[index]
+		addresses = append(addresses, wallets.Address{
+			Address:         account.BaseAddress,
+			Index:           index,
+			Balance:         account.Balance,
+			UnlockedBalance: account.UnlockedBalance,
+		})
+	}
+	return addresses, nil
+}
+
 func (w *Wallet) ValidateAddress(ctx context.Context, req wallets.ValidateAddressRequest) (err error) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -331,11 +527,166 @@ func (w *Wallet) Transaction(ctx context.Context, req wallets.TransactionRequest
 	return tx, nil
 }
 
+func (w *Wallet) IncomingTransfers(ctx context.Context, req wallets.IncomingTransfersRequest) (transfers []wallets.IncomingTransfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var getTransfers = rpc.GetTransfersRequest{
+		In:   true,
+		Pool: req.Pool,
+	}
+	if w.accounts {
+		getTransfers.AccountIndex = req.Index
+	} else {
+		getTransfers.AccountIndex = 0
+		getTransfers.SubaddrIndices = []uint64{req.Index}
+	}
+
+	batch, err := w.incomingTransfers(ctx, &getTransfers)
+	if err != nil {
+		return nil, err
+	}
+	return batch[req.Index], nil
+}
+
+// IncomingTransfersBatch lists the transfers of every requested address with a single get_transfers
+// call and at most one read of the daemon pool
+func (w *Wallet) IncomingTransfersBatch(ctx context.Context, req wallets.IncomingTransfersBatchRequest) (transfers map[uint64][]wallets.IncomingTransfer, err error) {
+	if len(req.Indices) == 0 {
+		return nil, nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var getTransfers = rpc.GetTransfersRequest{
+		In:   true,
+		Pool: req.Pool,
+	}
+	if w.accounts {
+		getTransfers.AllAccounts = true
+	} else {
+		getTransfers.AccountIndex = 0
+		getTransfers.SubaddrIndices = req.Indices
+	}
+
+	batch, err := w.incomingTransfers(ctx, &getTransfers)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers = make(map[uint64][]wallets.IncomingTransfer, len(req.Indices))
+	for _, index := range req.Indices {
+		if incoming, found := batch[index]; found {
+			transfers[index] = incoming
+		}
+	}
+	return transfers, nil
+}
+
+// Incoming transfers returned by get_transfers by address index
+func (w *Wallet) incomingTransfers(ctx context.Context, getTransfers *rpc.GetTransfersRequest) (transfers map[uint64][]wallets.IncomingTransfer, err error) {
+	res, err := w.client.GetTransfers(ctx, getTransfers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve transfers: %w", err)
+	}
+
+	transfers = make(map[uint64][]wallets.IncomingTransfer)
+	for _, transfer := range res.In {
+		key := w.transferKey(&transfer)
+		transfers[key.index] = append(transfers[key.index], wallets.IncomingTransfer{
+			TransactionId: transfer.Txid,
+			Amount:        transfer.Amount,
+			Confirmations: transfer.Confirmations,
+		})
+	}
+
+	if len(res.Pool) == 0 {
+		return transfers, nil
+	}
+
+	pool, err := w.daemonPool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve daemon pool: %w", err)
+	}
+	for _, transfer := range res.Pool {
+		if transfer.DoubleSpendSeen {
+			continue
+		}
+		// The wallet keeps transactions the daemon already dropped
+		if pool != nil {
+			if _, found := pool[transfer.Txid]; !found {
+				continue
+			}
+		}
+		key := w.transferKey(&transfer)
+		transfers[key.index] = append(transfers[key.index], wallets.IncomingTransfer{
+			TransactionId: transfer.Txid,
+			Amount:        transfer.Amount,
+			InPool:        true,
+		})
+	}
+	return transfers, nil
+}
+
+// Address spent by an outgoing transfer. The gateway never spends several addresses at once
+func (w *Wallet) sourceIndex(transfer *rpc.Transfer) (index uint64) {
+	switch {
+	case w.accounts:
+		return transfer.SubaddrIndex.Major
+	case len(transfer.SubaddrIndices) > 0:
+		return transfer.SubaddrIndices[0].Minor
+	default:
+		return transfer.SubaddrIndex.Minor
+	}
+}
+
 func New(config Config) (w *Wallet) {
 	w = &Wallet{
 		mutex:    new(sync.Mutex),
 		accounts: config.Accounts,
 		client:   config.Client,
+		daemon:   config.Daemon,
+
+		notifyInterval: config.NotifyInterval,
+	}
+	if w.notifyInterval == 0 {
+		w.notifyInterval = DefaultNotifyInterval
 	}
 	return w
 }
+
+func (w *Wallet) OutgoingTransfers(ctx context.Context, req wallets.OutgoingTransfersRequest) (transfers []wallets.OutgoingTransfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var getTransfers = rpc.GetTransfersRequest{
+		Out:     true,
+		Pending: true,
+	}
+	if w.accounts {
+		getTransfers.AccountIndex = req.Index
+	} else {
+		getTransfers.AccountIndex = 0
+		getTransfers.SubaddrIndices = []uint64{req.Index}
+	}
+
+	res, err := w.client.GetTransfers(ctx, &getTransfers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve transfers: %w", err)
+	}
+
+	for _, transfer := range append(res.Out, res.Pending...) {
+		outgoing := wallets.OutgoingTransfer{
+			TransactionId: transfer.Txid,
+			SourceIndex:   w.sourceIndex(&transfer),
+			Fee:           transfer.Fee,
+			Timestamp:     time.Unix(int64(transfer.Timestamp), 0),
+		}
+		for _, destination := range transfer.Destinations {
+			outgoing.Destinations = append(outgoing.Destinations, wallets.Destination{Address: destination.Address, Amount: destination.Amount})
+		}
+		transfers = append(transfers, outgoing)
+	}
+	return transfers, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
 	"github.com/RogueTeam/8ball/utils"
@@ -62,8 +63,8 @@ func Test_Monero(t *testing.T) {
 		assertions.Nil(err, "failed to open wallet")
 
 		var configs = []monero.Config{
-			{Client: client, Accounts: false},
-			{Client: client, Accounts: true},
+			{Client: client, Accounts: false, NotifyInterval: time.Second},
+			{Client: client, Accounts: true, NotifyInterval: time.Second},
 		}
 		for _, config := range configs {
 			cc, _ := json.Marshal(config)
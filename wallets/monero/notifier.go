@@ -0,0 +1,173 @@
+package monero
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Default interval between the polls of the subscriptions
+const DefaultNotifyInterval = 10 * time.Second
+
+// Blocks scanned again by every poll so transfers reorganized into later blocks are still noticed
+const notifyDepth = 10
+
+// Transfer received by an address. A transaction may pay several addresses of the wallet
+type transferKey struct {
+	transactionId string
+	index         uint64
+}
+
+// Diffs the transfers reported by get_transfers between polls
+type notifier struct {
+	wallet *Wallet
+	// Wallet height reached by the last poll
+	height uint64
+	// Transfers already notified with the height of their block. Zero while in the pool
+	seen map[transferKey]uint64
+}
+
+// Subscribe polls the transfers received since the last poll every NotifyInterval. Transfers
+// received before subscribing are not notified. Transfers mined before being seen in the pool
+// only emit the confirmed event
+func (w *Wallet) Subscribe(ctx context.Context) (events <-chan wallets.Event, err error) {
+	n := notifier{
+		wallet: w,
+		seen:   make(map[transferKey]uint64),
+	}
+
+	// The first poll only records the existing transfers
+	_, err = n.poll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll transfers: %w", err)
+	}
+
+	out := make(chan wallets.Event, 100)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(w.notifyInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// Failed polls are retried on the next tick. Subscribers keep polling as a fallback
+			polled, err := n.poll(ctx)
+			if err != nil {
+				continue
+			}
+			for _, event := range polled {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- event:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Returns the events of the transfers that changed since the previous poll
+func (n *notifier) poll(ctx context.Context) (events []wallets.Event, err error) {
+	err = n.wallet.Sync(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync wallet: %w", err)
+	}
+
+	res, height, err := n.wallet.recentTransfers(ctx, n.height)
+	if err != nil {
+		return nil, err
+	}
+
+	pooled := make(map[transferKey]struct{}, len(res.Pool))
+	for _, transfer := range res.Pool {
+		if transfer.DoubleSpendSeen {
+			continue
+		}
+
+		key := n.wallet.transferKey(&transfer)
+		pooled[key] = struct{}{}
+		if _, found := n.seen[key]; found {
+			continue
+		}
+		n.seen[key] = 0
+		events = append(events, n.event(wallets.EventIncoming, key, &transfer))
+	}
+
+	for _, transfer := range res.In {
+		key := n.wallet.transferKey(&transfer)
+		if mined, found := n.seen[key]; found && mined != 0 {
+			continue
+		}
+		n.seen[key] = transfer.Height
+		events = append(events, n.event(wallets.EventConfirmed, key, &transfer))
+	}
+
+	for key, mined := range n.seen {
+		// Dropped from the pool without being mined
+		if _, found := pooled[key]; mined == 0 && !found {
+			delete(n.seen, key)
+		}
+		// Out of the blocks scanned by the next poll
+		if mined != 0 && mined+notifyDepth < height {
+			delete(n.seen, key)
+		}
+	}
+
+	// Nothing is notified by the first poll
+	if n.height == 0 {
+		events = nil
+	}
+	n.height = height
+	return events, nil
+}
+
+func (n *notifier) event(t wallets.EventType, key transferKey, transfer *rpc.Transfer) (event wallets.Event) {
+	return wallets.Event{
+		Type:          t,
+		Index:         key.index,
+		TransactionId: key.transactionId,
+		Amount:        transfer.Amount,
+	}
+}
+
+// Incoming transfers in the pool and mined since the height, with the current wallet height
+func (w *Wallet) recentTransfers(ctx context.Context, since uint64) (res *rpc.GetTransfersResponse, height uint64, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var getTransfers = rpc.GetTransfersRequest{
+		In:          true,
+		Pool:        true,
+		AllAccounts: w.accounts,
+	}
+	if since > notifyDepth {
+		getTransfers.FilterByHeight = true
+		getTransfers.MinHeight = since - notifyDepth
+	}
+
+	res, err = w.client.GetTransfers(ctx, &getTransfers)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve transfers: %w", err)
+	}
+	return res, w.height, nil
+}
+
+func (w *Wallet) transferKey(transfer *rpc.Transfer) (key transferKey) {
+	key.transactionId = transfer.Txid
+	if w.accounts {
+		key.index = transfer.SubaddrIndex.Major
+	} else {
+		key.index = transfer.SubaddrIndex.Minor
+	}
+	return key
+}
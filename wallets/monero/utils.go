@@ -23,6 +23,44 @@ func convertPriority(p wallets.Priority) (priority rpc.Priority, err error) {
 	}
 }
 
+// Transactions in the pool of the daemon. Nil when no daemon was configured
+func (w *Wallet) daemonPool(ctx context.Context) (pool map[string]struct{}, err error) {
+	if w.daemon == nil {
+		return nil, nil
+	}
+
+	res, err := w.daemon.GetTransactionPool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction pool: %w", err)
+	}
+
+	pool = make(map[string]struct{}, len(res.Transactions))
+	for _, tx := range res.Transactions {
+		if tx.DoubleSpendSeen {
+			continue
+		}
+		pool[tx.IdHash] = struct{}{}
+	}
+	return pool, nil
+}
+
+// Marks the wallet-rpc errors that fail the same way when retried
+func classify(err error) (classified error) {
+	isWalletError, werr := rpc.GetWalletError(err)
+	if !isWalletError {
+		return err
+	}
+
+	switch werr.Code {
+	case rpc.ErrWrongAddress:
+		return fmt.Errorf("%w: %w", wallets.ErrInvalidAddress, err)
+	case rpc.ErrDenied, rpc.ErrWrongPaymentID, rpc.ErrTransferType:
+		return fmt.Errorf("%w: %w", wallets.ErrPermanent, err)
+	default:
+		return err
+	}
+}
+
 func (w *Wallet) validateAddress(ctx context.Context, address string) (err error) {
 	var validate = rpc.ValidateAddressRequest{
 		Address: address,
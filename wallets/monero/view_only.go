@@ -0,0 +1,157 @@
+package monero
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RogueTeam/8ball/internal/walletrpc/rpc"
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Wallets holding the spend key sign the transfers themselves
+var ErrNotViewOnly = fmt.Errorf("%w: wallet is not view-only", wallets.ErrPermanent)
+
+var _ wallets.ViewOnly = (*Wallet)(nil)
+
+// PrepareTransfer never relays the transfer. Wallets holding the spend key fail with ErrNotViewOnly
+func (w *Wallet) PrepareTransfer(ctx context.Context, req wallets.TransferRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	trans, err := w.transferRequest(ctx, req)
+	if err != nil {
+		return unsigned, err
+	}
+
+	trans.DoNotRelay = true
+	res, err := w.client.Transfer(ctx, &trans)
+	if err != nil {
+		return unsigned, fmt.Errorf("failed to prepare transfer: %w", classify(err))
+	}
+	if res.UnsignedTxset == "" {
+		return unsigned, ErrNotViewOnly
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		Txset:        res.UnsignedTxset,
+		SourceIndex:  req.SourceIndex,
+		Destinations: []wallets.Destination{{Address: req.Destination, Amount: res.Amount}},
+		Fee:          res.Fee,
+	}
+	return unsigned, nil
+}
+
+// PrepareSweep never relays the sweep. Wallets holding the spend key fail with ErrNotViewOnly
+func (w *Wallet) PrepareSweep(ctx context.Context, req wallets.SweepRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	trans, err := w.sweepRequest(ctx, req)
+	if err != nil {
+		return unsigned, err
+	}
+
+	trans.DoNotRelay = true
+	res, err := w.client.SweepAll(ctx, &trans)
+	if err != nil {
+		return unsigned, fmt.Errorf("failed to prepare sweep: %w", classify(err))
+	}
+	if res.UnsignedTxset == "" {
+		return unsigned, ErrNotViewOnly
+	}
+	if len(res.AmountList) != 1 || len(res.FeeList) != 1 {
+		return unsigned, errors.New("sweep prepared in more than one transaction")
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		Txset:        res.UnsignedTxset,
+		SourceIndex:  req.SourceIndex,
+		Destinations: []wallets.Destination{{Address: req.Destination, Amount: utils.MapInt[int, uint64](res.AmountList)[0]}},
+		Fee:          utils.MapInt[int, uint64](res.FeeList)[0],
+	}
+	return unsigned, nil
+}
+
+// PrepareTransferMany never relays the transfer. Wallets holding the spend key fail with ErrNotViewOnly
+func (w *Wallet) PrepareTransferMany(ctx context.Context, req wallets.TransferManyRequest) (unsigned wallets.UnsignedTransfer, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	trans, err := w.transferManyRequest(ctx, req)
+	if err != nil {
+		return unsigned, err
+	}
+
+	trans.DoNotRelay = true
+	res, err := w.client.Transfer(ctx, &trans)
+	if err != nil {
+		return unsigned, fmt.Errorf("failed to prepare transfer: %w", classify(err))
+	}
+	if res.UnsignedTxset == "" {
+		return unsigned, ErrNotViewOnly
+	}
+
+	unsigned = wallets.UnsignedTransfer{
+		Txset:       res.UnsignedTxset,
+		SourceIndex: req.SourceIndex,
+		Fee:         res.Fee,
+	}
+	for _, destination := range trans.Destinations {
+		unsigned.Destinations = append(unsigned.Destinations, wallets.Destination{Address: destination.Address, Amount: destination.Amount})
+	}
+	return unsigned, nil
+}
+
+func (w *Wallet) Submit(ctx context.Context, req wallets.SubmitRequest) (transactionIds []string, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	res, err := w.client.SubmitTransfer(ctx, &rpc.SubmitTransferRequest{TxDataHex: req.Txset})
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit transfer: %w", classify(err))
+	}
+
+	err = w.client.Store(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save changes: %w", err)
+	}
+	return res.TxHashList, nil
+}
+
+// ExportOutputs exports every output. The offline wallet can't sign transfers spending unknown outputs
+func (w *Wallet) ExportOutputs(ctx context.Context) (outputs string, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	res, err := w.client.ExportOutputs(ctx, &rpc.ExportOutputsRequest{All: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to export outputs: %w", err)
+	}
+	return res.OutputsDataHex, nil
+}
+
+func (w *Wallet) ImportKeyImages(ctx context.Context, req wallets.ImportKeyImagesRequest) (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var importKeyImages rpc.ImportKeyImagesRequest
+	for _, keyImage := range req.KeyImages {
+		importKeyImages.SignedKeyImages = append(importKeyImages.SignedKeyImages, rpc.SignedKeyImage{
+			KeyImage:  keyImage.KeyImage,
+			Signature: keyImage.Signature,
+		})
+	}
+
+	_, err = w.client.ImportKeyImages(ctx, &importKeyImages)
+	if err != nil {
+		return fmt.Errorf("failed to import key images: %w", err)
+	}
+
+	err = w.client.Store(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save changes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RogueTeam/8ball/wallets"
+)
+
+// Low bits of an index holding the index inside its backend. The high bits hold the backend id
+const IndexBits = 48
+
+// Maximum number of backends addressable by the high bits of the indices
+const MaxBackends = 1 << (64 - IndexBits)
+
+const localMask = 1<<IndexBits - 1
+
+var (
+	ErrNoBackends      = errors.New("no backends configured")
+	ErrTooManyBackends = fmt.Errorf("more than %d backends configured", MaxBackends)
+	ErrUnknownBackend  = fmt.Errorf("%w: unknown backend", wallets.ErrPermanent)
+	// The backend returned an index colliding with the backend id
+	ErrIndexOverflow = errors.New("backend index overflows the pool index")
+	ErrUnsupported   = fmt.Errorf("%w: unsupported by the backend", wallets.ErrPermanent)
+)
+
+// Index encodes the backend id into the index of the backend
+func Index(backend, index uint64) (pooled uint64) {
+	return backend<<IndexBits | index
+}
+
+// Split returns the backend id and the index inside the backend
+func Split(pooled uint64) (backend, index uint64) {
+	return pooled >> IndexBits, pooled & localMask
+}
+
+type Config struct {
+	// Wallets sharing the receivers. The position of a backend is its id, encoded in every index it
+	// creates, so backends can only be appended
+	Backends []wallets.Wallet
+}
+
+// Pool fans out over several wallets. New addresses are created by the backends in turns and
+// every call is routed to the backend owning the index. Index 0 belongs to the first backend
+type Pool struct {
+	backends []wallets.Wallet
+	next     atomic.Uint64
+}
+
+var (
+	_ wallets.Wallet          = (*Pool)(nil)
+	_ wallets.MultiTransferer = (*Pool)(nil)
+	_ wallets.BatchAddresser  = (*Pool)(nil)
+	_ wallets.Notifier        = (*Pool)(nil)
+
+	_ wallets.BatchIncomingTransferer = (*Pool)(nil)
+)
+
+func New(config Config) (p *Pool, err error) {
+	switch {
+	case len(config.Backends) == 0:
+		return nil, ErrNoBackends
+	case len(config.Backends) > MaxBackends:
+		return nil, ErrTooManyBackends
+	}
+
+	p = &Pool{backends: config.Backends}
+	return p, nil
+}
+
+// Returns the backend owning the index and the index inside it
+func (p *Pool) route(pooled uint64) (backend wallets.Wallet, index uint64, err error) {
+	id, index := Split(pooled)
+	if id >= uint64(len(p.backends)) {
+		return nil, index, fmt.Errorf("%w: %d", ErrUnknownBackend, id)
+	}
+	return p.backends[id], index, nil
+}
+
+// Encodes the index returned by a backend
+func (p *Pool) pooled(backend, index uint64) (pooled uint64, err error) {
+	if index > localMask {
+		return 0, fmt.Errorf("%w: %d", ErrIndexOverflow, index)
+	}
+	return Index(backend, index), nil
+}
+
+// Sync syncs every backend at the same time
+func (p *Pool) Sync(ctx context.Context, full bool) (err error) {
+	errs := make([]error, len(p.backends))
+
+	var wg sync.WaitGroup
+	for id, backend := range p.backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := backend.Sync(ctx, full)
+			if err != nil {
+				errs[id] = fmt.Errorf("failed to sync backend %d: %w", id, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (p *Pool) NewAddress(ctx context.Context, req wallets.NewAddressRequest) (address wallets.Address, err error) {
+	id := (p.next.Add(1) - 1) % uint64(len(p.backends))
+
+	address, err = p.backends[id].NewAddress(ctx, req)
+	if err != nil {
+		return address, fmt.Errorf("failed to create address in backend %d: %w", id, err)
+	}
+
+	address.Index, err = p.pooled(id, address.Index)
+	if err != nil {
+		return address, err
+	}
+	return address, nil
+}
+
+func (p *Pool) SweepAll(ctx context.Context, req wallets.SweepRequest) (sweep wallets.Sweep, err error) {
+	backend, index, err := p.route(req.SourceIndex)
+	if err != nil {
+		return sweep, err
+	}
+
+	pooled := req.SourceIndex
+	req.SourceIndex = index
+	sweep, err = backend.SweepAll(ctx, req)
+	sweep.SourceIndex = pooled
+	return sweep, err
+}
+
+func (p *Pool) Transfer(ctx context.Context, req wallets.TransferRequest) (transfer wallets.Transfer, err error) {
+	backend, index, err := p.route(req.SourceIndex)
+	if err != nil {
+		return transfer, err
+	}
+
+	pooled := req.SourceIndex
+	req.SourceIndex = index
+	transfer, err = backend.Transfer(ctx, req)
+	transfer.SourceIndex = pooled
+	return transfer, err
+}
+
+// TransferMany fails with ErrUnsupported when the owning backend can't pay several destinations
+func (p *Pool) TransferMany(ctx context.Context, req wallets.TransferManyRequest) (transfer wallets.TransferMany, err error) {
+	backend, index, err := p.route(req.SourceIndex)
+	if err != nil {
+		return transfer, err
+	}
+
+	multi, ok := backend.(wallets.MultiTransferer)
+	if !ok {
+		return transfer, fmt.Errorf("%w: multiple destinations", ErrUnsupported)
+	}
+
+	pooled := req.SourceIndex
+	req.SourceIndex = index
+	transfer, err = multi.TransferMany(ctx, req)
+	transfer.SourceIndex = pooled
+	return transfer, err
+}
+
+func (p *Pool) Address(ctx context.Context, req wallets.AddressRequest) (address wallets.Address, err error) {
+	backend, index, err := p.route(req.Index)
+	if err != nil {
+		return address, err
+	}
+
+	address, err = backend.Address(ctx, wallets.AddressRequest{Index: index})
+	address.Index = req.Index
+	return address, err
+}
+
+// Addresses retrieves the addresses of each backend in a single batch
+func (p *Pool) Addresses(ctx context.Context, req wallets.AddressesRequest) (addresses []wallets.Address, err error) {
+	batches := make(map[uint64][]uint64)
+	for _, pooled := range req.Indices {
+		id, index := Split(pooled)
+		if id >= uint64(len(p.backends)) {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownBackend, id)
+		}
+		batches[id] = append(batches[id], index)
+	}
+
+	found := make(map[uint64]wallets.Address, len(req.Indices))
+	for id, indices := range batches {
+		batch, err := wallets.Addresses(ctx, p.backends[id], wallets.AddressesRequest{Indices: indices})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve addresses of backend %d: %w", id, err)
+		}
+		for _, address := range batch {
+			address.Index = Index(id, address.Index)
+			found[address.Index] = address
+		}
+	}
+
+	addresses = make([]wallets.Address, 0, len(req.Indices))
+	for _, pooled := range req.Indices {
+		addresses = append(addresses, found[pooled])
+	}
+	return addresses, nil
+}
+
+// ValidateAddress is answered by the first backend. Every backend runs on the same network
+func (p *Pool) ValidateAddress(ctx context.Context, req wallets.ValidateAddressRequest) (err error) {
+	return p.backends[0].ValidateAddress(ctx, req)
+}
+
+func (p *Pool) Transaction(ctx context.Context, req wallets.TransactionRequest) (tx wallets.Transaction, err error) {
+	backend, index, err := p.route(req.SourceIndex)
+	if err != nil {
+		return tx, err
+	}
+
+	req.SourceIndex = index
+	return backend.Transaction(ctx, req)
+}
+
+func (p *Pool) IncomingTransfers(ctx context.Context, req wallets.IncomingTransfersRequest) (transfers []wallets.IncomingTransfer, err error) {
+	backend, index, err := p.route(req.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Index = index
+	return backend.IncomingTransfers(ctx, req)
+}
+
+// IncomingTransfersBatch lists the transfers of each backend in a single batch
+func (p *Pool) IncomingTransfersBatch(ctx context.Context, req wallets.IncomingTransfersBatchRequest) (transfers map[uint64][]wallets.IncomingTransfer, err error) {
+	batches := make(map[uint64][]uint64)
+	for _, pooled := range req.Indices {
+		id, index := Split(pooled)
+		if id >= uint64(len(p.backends)) {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownBackend, id)
+		}
+		batches[id] = append(batches[id], index)
+	}
+
+	transfers = make(map[uint64][]wallets.IncomingTransfer, len(req.Indices))
+	for id, indices := range batches {
+		batch, err := wallets.IncomingTransfersBatch(ctx, p.backends[id], wallets.IncomingTransfersBatchRequest{Indices: indices, Pool: req.Pool})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve incoming transfers of backend %d: %w", id, err)
+		}
+		for index, incoming := range batch {
+			transfers[Index(id, index)] = incoming
+		}
+	}
+	return transfers, nil
+}
+
+func (p *Pool) OutgoingTransfers(ctx context.Context, req wallets.OutgoingTransfersRequest) (transfers []wallets.OutgoingTransfer, err error) {
+	backend, index, err := p.route(req.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := Split(req.Index)
+	req.Index = index
+	transfers, err = backend.OutgoingTransfers(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range transfers {
+		transfers[i].SourceIndex = Index(id, transfers[i].SourceIndex)
+	}
+	return transfers, nil
+}
+
+// Subscribe merges the events of the backends able to notify. Fails with ErrUnsupported when none is
+func (p *Pool) Subscribe(ctx context.Context) (events <-chan wallets.Event, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	out := make(chan wallets.Event, 100)
+	var wg sync.WaitGroup
+	var subscribed int
+	for id, backend := range p.backends {
+		notifier, ok := backend.(wallets.Notifier)
+		if !ok {
+			continue
+		}
+		subscribed++
+
+		backendEvents, err := notifier.Subscribe(ctx)
+		if err != nil {
+			cancel()
+			wg.Wait()
+			return nil, fmt.Errorf("failed to subscribe to backend %d: %w", id, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for event := range backendEvents {
+				event.Index = Index(uint64(id), event.Index)
+				select {
+				case <-ctx.Done():
+				case out <- event:
+				}
+			}
+		}()
+	}
+
+	if subscribed == 0 {
+		cancel()
+		return nil, fmt.Errorf("%w: notifications", ErrUnsupported)
+	}
+
+	// Closes the merged channel once every backend closed its own
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package pool_test
+
+import (
+	"testing"
+
+	"github.com/RogueTeam/8ball/utils"
+	"github.com/RogueTeam/8ball/wallets"
+	"github.com/RogueTeam/8ball/wallets/mock"
+	"github.com/RogueTeam/8ball/wallets/pool"
+	"github.com/RogueTeam/8ball/wallets/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Pool(t *testing.T) {
+	t.Run("Single", func(t *testing.T) {
+		t.Parallel()
+
+		assertions := assert.New(t)
+
+		p, err := pool.New(pool.Config{Backends: []wallets.Wallet{mock.New(mock.Config{})}})
+		if !assertions.Nil(err, "failed to create pool") {
+			return
+		}
+		testsuite.Test(t, p, &testsuite.MockGenerator{})
+	})
+	t.Run("Routing", func(t *testing.T) {
+		t.Parallel()
+
+		assertions := assert.New(t)
+
+		ctx, cancel := utils.NewContext()
+		defer cancel()
+
+		_, err := pool.New(pool.Config{})
+		assertions.ErrorIs(err, pool.ErrNoBackends, "pools need a backend")
+
+		backends := []wallets.Wallet{mock.New(mock.Config{}), mock.New(mock.Config{})}
+		p, err := pool.New(pool.Config{Backends: backends})
+		if !assertions.Nil(err, "failed to create pool") {
+			return
+		}
+
+		first, err := p.NewAddress(ctx, wallets.NewAddressRequest{})
+		assertions.Nil(err, "failed to create first address")
+		second, err := p.NewAddress(ctx, wallets.NewAddressRequest{})
+		assertions.Nil(err, "failed to create second address")
+
+		backend, index := pool.Split(first.Index)
+		assertions.EqualValues(0, backend, "first address should be created by the first backend")
+		assertions.EqualValues(1, index, "invalid index in the first backend")
+		backend, index = pool.Split(second.Index)
+		assertions.EqualValues(1, backend, "second address should be created by the second backend")
+		assertions.EqualValues(1, index, "invalid index in the second backend")
+
+		events, err := p.Subscribe(ctx)
+		if !assertions.Nil(err, "failed to subscribe") {
+			return
+		}
+
+		// The funds of the second backend live in its own index 0
+		transfer, err := p.Transfer(ctx, wallets.TransferRequest{
+			SourceIndex: pool.Index(1, 0),
+			Destination: second.Address,
+			Amount:      1000000,
+			Priority:    wallets.PriorityHigh,
+		})
+		if !assertions.Nil(err, "failed to transfer") {
+			return
+		}
+		assertions.Equal(pool.Index(1, 0), transfer.SourceIndex, "source index should be pooled")
+
+		outgoing, err := p.OutgoingTransfers(ctx, wallets.OutgoingTransfersRequest{Index: pool.Index(1, 0)})
+		if assertions.Nil(err, "failed to list outgoing transfers") && assertions.Len(outgoing, 1, "invalid number of outgoing transfers") {
+			assertions.Equal(pool.Index(1, 0), outgoing[0].SourceIndex, "outgoing source index should be pooled")
+		}
+
+		event := <-events
+		assertions.Equal(second.Index, event.Index, "event index should be pooled")
+
+		addresses, err := p.Addresses(ctx, wallets.AddressesRequest{Indices: []uint64{second.Index, first.Index}})
+		if assertions.Nil(err, "failed to retrieve addresses") && assertions.Len(addresses, 2, "invalid number of addresses") {
+			assertions.Equal(second, wallets.Address{Address: addresses[0].Address, Index: addresses[0].Index}, "addresses should follow the request")
+			assertions.EqualValues(1000000, addresses[0].Balance, "second address should be funded")
+			assertions.Equal(first, addresses[1], "addresses should follow the request")
+		}
+
+		_, err = p.Address(ctx, wallets.AddressRequest{Index: pool.Index(2, 0)})
+		assertions.ErrorIs(err, pool.ErrUnknownBackend, "unknown backends should fail")
+	})
+}
@@ -1,6 +1,7 @@
 package testsuite
 
 import (
+	"slices"
 	"testing"
 	"time"
 
@@ -70,6 +71,11 @@ func Test(t *testing.T, w wallets.Wallet, gen DataGenerator) {
 		address2, err := w.NewAddress(ctx, wallets.NewAddressRequest{Label: label2})
 		assertions.Nil(err, "failed to create second new address")
 		assertions.Less(address.Index, address2.Index, "second address index should be incremented")
+
+		// Both addresses can be retrieved at once
+		addresses, err := wallets.Addresses(ctx, w, wallets.AddressesRequest{Indices: []uint64{address2.Index, address.Index}})
+		assertions.Nil(err, "failed to retrieve addresses")
+		assertions.Equal([]wallets.Address{address2, address}, addresses, "addresses should be returned in the order of the request")
 	})
 
 	t.Run("ValidateAddress", func(t *testing.T) {
@@ -157,6 +163,76 @@ func Test(t *testing.T, w wallets.Wallet, gen DataGenerator) {
 			assertions.True(found, "Destination address balance should increase by net transfer amount")
 			assertions.Equal(wallets.TransactionStatusCompleted, tx.Status, "status doesn't match")
 			t.Log("[+] Transaction found")
+
+			incoming, err := w.IncomingTransfers(ctx, wallets.IncomingTransfersRequest{Index: dst.Index})
+			assertions.Nil(err, "failed to list incoming transfers")
+			if assertions.Len(incoming, 1, "destination should have a single incoming transfer") {
+				assertions.Equal(transfer.Address, incoming[0].TransactionId, "transaction id doesn't match")
+				assertions.Equal(transfer.Amount, incoming[0].Amount, "amount doesn't match")
+				assertions.NotZero(incoming[0].Confirmations, "completed transfer should be confirmed")
+			}
+
+			batch, err := wallets.IncomingTransfersBatch(ctx, w, wallets.IncomingTransfersBatchRequest{Indices: []uint64{dst.Index}})
+			assertions.Nil(err, "failed to list incoming transfers in batch")
+			assertions.Equal(incoming, batch[dst.Index], "batch should match the single listing")
+
+			outgoing, err := w.OutgoingTransfers(ctx, wallets.OutgoingTransfersRequest{Index: 0})
+			assertions.Nil(err, "failed to list outgoing transfers")
+			index := slices.IndexFunc(outgoing, func(o wallets.OutgoingTransfer) bool { return o.TransactionId == transfer.Address })
+			if assertions.NotEqual(-1, index, "transfer should be listed as outgoing") {
+				assertions.Contains(outgoing[index].Destinations, wallets.Destination{Address: dst.Address, Amount: transfer.Amount}, "destination doesn't match")
+				assertions.EqualValues(0, outgoing[index].SourceIndex, "source index doesn't match")
+			}
+		})
+
+		t.Run("To Multiple Destinations", func(t *testing.T) {
+			t.Parallel()
+
+			assertions := assert.New(t)
+
+			multi, ok := w.(wallets.MultiTransferer)
+			if !ok {
+				t.Skip("wallet doesn't support multiple destinations")
+			}
+
+			ctx, cancel := utils.NewContextWithTimeout(time.Hour)
+			defer cancel()
+
+			err := w.Sync(ctx, true)
+			assertions.Nil(err, "failed to sync")
+
+			dst1, err := w.NewAddress(ctx, wallets.NewAddressRequest{Label: random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)})
+			assertions.Nil(err, "failed to create first destination")
+			dst2, err := w.NewAddress(ctx, wallets.NewAddressRequest{Label: random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)})
+			assertions.Nil(err, "failed to create second destination")
+
+			transfer, err := multi.TransferMany(ctx, wallets.TransferManyRequest{
+				SourceIndex: 0,
+				Destinations: []wallets.Destination{
+					{Address: dst1.Address, Amount: gen.TransferAmount()},
+					{Address: dst2.Address, Amount: gen.TransferAmount()},
+				},
+				SubtractFeeFrom: 1,
+				Priority:        wallets.PriorityHigh,
+				UnlockTime:      0,
+			})
+			if !assertions.Nil(err, "failed to transfer to multiple destinations") {
+				return
+			}
+			assertions.NotEmpty(transfer.Address, "transfer should have a transaction address")
+			assertions.NotZero(transfer.Fee, "transfer should have a fee")
+			if assertions.Len(transfer.Destinations, 2, "invalid number of destinations") {
+				assertions.Equal(gen.TransferAmount(), transfer.Destinations[0].Amount, "first destination should receive the entire amount")
+				assertions.Equal(gen.TransferAmount()-transfer.Fee, transfer.Destinations[1].Amount, "second destination should pay the fee")
+			}
+
+			_, err = multi.TransferMany(ctx, wallets.TransferManyRequest{
+				SourceIndex:     0,
+				Destinations:    []wallets.Destination{{Address: dst1.Address, Amount: gen.TransferAmount()}},
+				SubtractFeeFrom: 1,
+				Priority:        wallets.PriorityHigh,
+			})
+			assertions.ErrorIs(err, wallets.ErrInvalidDestinations, "fee should be subtracted from a known destination")
 		})
 
 		t.Run("Insufficient Funds", func(t *testing.T) {
@@ -438,4 +514,53 @@ func Test(t *testing.T, w wallets.Wallet, gen DataGenerator) {
 			t.Logf("Attempted sweep from non-existent address, got expected error: %v", err)
 		})
 	})
+
+	t.Run("Subscribe", func(t *testing.T) {
+		t.Parallel()
+
+		assertions := assert.New(t)
+
+		notifier, ok := w.(wallets.Notifier)
+		if !ok {
+			t.Skip("wallet doesn't support notifications")
+		}
+
+		ctx, cancel := utils.NewContextWithTimeout(time.Hour)
+		defer cancel()
+
+		err := w.Sync(ctx, true)
+		assertions.Nil(err, "failed to sync")
+
+		dst, err := w.NewAddress(ctx, wallets.NewAddressRequest{Label: random.String(random.PseudoRand, random.CharsetAlphaNumeric, 10)})
+		assertions.Nil(err, "failed to create destination")
+
+		subscriptionCtx, stop := utils.NewContextWithTimeout(time.Minute)
+		defer stop()
+
+		events, err := notifier.Subscribe(subscriptionCtx)
+		if !assertions.Nil(err, "failed to subscribe") {
+			return
+		}
+
+		transfer, err := w.Transfer(ctx, wallets.TransferRequest{
+			SourceIndex: 0,
+			Destination: dst.Address,
+			Amount:      gen.TransferAmount(),
+			Priority:    wallets.PriorityHigh,
+			UnlockTime:  0,
+		})
+		if !assertions.Nil(err, "failed to transfer") {
+			return
+		}
+
+		for event := range events {
+			if event.Index != dst.Index {
+				continue
+			}
+			assertions.Equal(transfer.Address, event.TransactionId, "invalid transaction")
+			assertions.Equal(gen.TransferAmount(), event.Amount, "invalid amount")
+			return
+		}
+		t.Fatal("no event received for the destination")
+	})
 }
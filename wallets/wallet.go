@@ -5,9 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 )
 
-var ErrInvalidPriority = errors.New("invalid priority")
+var (
+	ErrInvalidPriority = errors.New("invalid priority")
+	// The network fee is larger than the destination that should pay it
+	ErrFeeExceedsAmount    = errors.New("network fee exceeds destination amount")
+	ErrInvalidDestinations = errors.New("invalid destinations")
+	// Errors wrapping ErrPermanent fail the same way when retried
+	ErrPermanent      = errors.New("permanent error")
+	ErrInvalidAddress = fmt.Errorf("%w: invalid address", ErrPermanent)
+)
 
 const (
 	PriorityLow    Priority = "low"
@@ -31,6 +40,10 @@ type (
 		// Index of the address
 		Index uint64
 	}
+	AddressesRequest struct {
+		// Indices of the addresses
+		Indices []uint64
+	}
 	NewAddressRequest struct {
 		// Label for the new address
 		Label string
@@ -40,7 +53,7 @@ type (
 		Address string
 		// Index of the address
 		Index uint64
-		// Total balance of the address
+		// Total balance of the address. Transfers still in the pool are excluded
 		Balance uint64
 		// Balannce ready to use
 		UnlockedBalance uint64
@@ -91,6 +104,34 @@ type (
 		// Fee applied to the transaction
 		Fee uint64
 	}
+	Destination struct {
+		// Address receiving the funds
+		Address string
+		// Amount to transfer
+		Amount uint64
+	}
+	TransferManyRequest struct {
+		// Source address index
+		SourceIndex uint64
+		// Destinations paid in the same transaction
+		Destinations []Destination
+		// Index of the destination discounted with the network fee
+		SubtractFeeFrom uint64
+		// Priority of the transaction
+		Priority Priority
+		// Unlock time (blocks)
+		UnlockTime uint64
+	}
+	TransferMany struct {
+		// Address of the transaction
+		Address string
+		// Source address index
+		SourceIndex uint64
+		// Destinations with the amounts actually transfered
+		Destinations []Destination
+		// Fee applied to the transaction
+		Fee uint64
+	}
 	ValidateAddressRequest struct {
 		Address string
 	}
@@ -104,6 +145,66 @@ type (
 		Destination string
 		Status      TransactionStatus
 	}
+	IncomingTransfersRequest struct {
+		// Index of the address
+		Index uint64
+		// Include the transfers still in the pool
+		Pool bool
+	}
+	IncomingTransfersBatchRequest struct {
+		// Indices of the addresses
+		Indices []uint64
+		// Include the transfers still in the pool
+		Pool bool
+	}
+	IncomingTransfer struct {
+		// Transaction that sent the funds
+		TransactionId string
+		// Amount received
+		Amount uint64
+		// Blocks mined on top of the block containing the transaction
+		Confirmations uint64
+		// The transaction is in the pool waiting to be mined
+		InPool bool
+	}
+	OutgoingTransfersRequest struct {
+		// Index of the address
+		Index uint64
+	}
+	UnsignedTransfer struct {
+		// Unsigned transaction set. Only the wallet holding the spend key can sign it
+		Txset string
+		// Source address index
+		SourceIndex uint64
+		// Destinations with the amounts to transfer
+		Destinations []Destination
+		// Fee applied to the transaction
+		Fee uint64
+	}
+	SubmitRequest struct {
+		// Transaction set signed by the wallet holding the spend key
+		Txset string
+	}
+	KeyImage struct {
+		KeyImage  string
+		Signature string
+	}
+	ImportKeyImagesRequest struct {
+		// Key images signed by the wallet holding the spend key
+		KeyImages []KeyImage
+	}
+	OutgoingTransfer struct {
+		// Transaction that sent the funds
+		TransactionId string
+		// Index of the address spent by the transaction
+		SourceIndex uint64
+		// Destinations with the amounts transfered
+		Destinations []Destination
+		// Fee applied to the transaction
+		Fee uint64
+		// Moment the transaction was submitted. Mined transactions report the time of their block
+		Timestamp time.Time
+	}
 )
 
 type TransactionStatus string
@@ -135,6 +236,124 @@ type Wallet interface {
 
 	// Query the status of a transaction
 	Transaction(ctx context.Context, req TransactionRequest) (tx Transaction, err error)
+
+	// Lists the transfers received by an address
+	IncomingTransfers(ctx context.Context, req IncomingTransfersRequest) (transfers []IncomingTransfer, err error)
+
+	// Lists the transfers sent from an address, including the ones still in the pool. Failed transfers are excluded
+	OutgoingTransfers(ctx context.Context, req OutgoingTransfersRequest) (transfers []OutgoingTransfer, err error)
+}
+
+// Optional interface of the wallets able to pay several destinations in a single transaction
+type MultiTransferer interface {
+	// Transfers to multiple destinations. The network fee is discounted from the destination
+	// referenced by SubtractFeeFrom
+	TransferMany(ctx context.Context, req TransferManyRequest) (transfer TransferMany, err error)
+}
+
+// Optional interface of the wallets able to retrieve several addresses at once
+type BatchAddresser interface {
+	// Returns the addresses in the order of the request
+	Addresses(ctx context.Context, req AddressesRequest) (addresses []Address, err error)
+}
+
+// Optional interface of the wallets able to list the incoming transfers of several addresses at once
+type BatchIncomingTransferer interface {
+	// Returns the transfers by address index. Addresses without transfers are missing
+	IncomingTransfersBatch(ctx context.Context, req IncomingTransfersBatchRequest) (transfers map[uint64][]IncomingTransfer, err error)
+}
+
+type EventType string
+
+const (
+	// Funds sent to an address were seen, usually in the pool
+	EventIncoming EventType = "incoming"
+	// A transfer to an address was mined
+	EventConfirmed EventType = "confirmed"
+)
+
+// Change in the funds received by an address
+type Event struct {
+	Type EventType
+	// Index of the address receiving the funds
+	Index uint64
+	// Transaction that sent the funds
+	TransactionId string
+	// Amount received
+	Amount uint64
+}
+
+// Optional interface of the wallets able to push the transfers received by their addresses
+type Notifier interface {
+	// Emits the events until the context is canceled, then closes the channel. Events may be
+	// dropped when the subscriber falls behind so consumers should keep polling as a fallback
+	Subscribe(ctx context.Context) (events <-chan Event, err error)
+}
+
+// Optional interface of the view-only wallets. Their transfers are prepared unsigned, signed by an
+// offline wallet holding the spend key and submitted afterwards
+type ViewOnly interface {
+	// Prepares a transfer to a destination without relaying it
+	PrepareTransfer(ctx context.Context, req TransferRequest) (unsigned UnsignedTransfer, err error)
+	// Prepares the transfer of the entire balance of an address without relaying it
+	PrepareSweep(ctx context.Context, req SweepRequest) (unsigned UnsignedTransfer, err error)
+	// Prepares a transfer to multiple destinations without relaying it. The network fee is
+	// discounted from the destination referenced by SubtractFeeFrom
+	PrepareTransferMany(ctx context.Context, req TransferManyRequest) (unsigned UnsignedTransfer, err error)
+	// Relays a transaction set signed offline. Returns the ids of its transactions
+	Submit(ctx context.Context, req SubmitRequest) (transactionIds []string, err error)
+	// Exports the outputs the offline wallet needs to sign the transfers
+	ExportOutputs(ctx context.Context) (outputs string, err error)
+	// Imports the key images of the offline wallet so the spent outputs are known
+	ImportKeyImages(ctx context.Context, req ImportKeyImagesRequest) (err error)
+}
+
+// Addresses retrieves several addresses in a single call when the wallet implements BatchAddresser.
+// Otherwise each address is retrieved on its own
+func Addresses(ctx context.Context, w Wallet, req AddressesRequest) (addresses []Address, err error) {
+	if batch, ok := w.(BatchAddresser); ok {
+		return batch.Addresses(ctx, req)
+	}
+
+	addresses = make([]Address, 0, len(req.Indices))
+	for _, index := range req.Indices {
+		address, err := w.Address(ctx, AddressRequest{Index: index})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve address %d: %w", index, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// IncomingTransfersBatch lists the transfers of several addresses in a single call when the wallet
+// implements BatchIncomingTransferer. Otherwise each address is listed on its own
+func IncomingTransfersBatch(ctx context.Context, w Wallet, req IncomingTransfersBatchRequest) (transfers map[uint64][]IncomingTransfer, err error) {
+	if batch, ok := w.(BatchIncomingTransferer); ok {
+		return batch.IncomingTransfersBatch(ctx, req)
+	}
+
+	transfers = make(map[uint64][]IncomingTransfer, len(req.Indices))
+	for _, index := range req.Indices {
+		incoming, err := w.IncomingTransfers(ctx, IncomingTransfersRequest{Index: index, Pool: req.Pool})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve incoming transfers of %d: %w", index, err)
+		}
+		if len(incoming) > 0 {
+			transfers[index] = incoming
+		}
+	}
+	return transfers, nil
+}
+
+func (r *TransferManyRequest) Validate() (err error) {
+	if len(r.Destinations) == 0 {
+		return fmt.Errorf("%w: no destinations", ErrInvalidDestinations)
+	}
+	if r.SubtractFeeFrom >= uint64(len(r.Destinations)) {
+		return fmt.Errorf("%w: fee subtracted from unknown destination: %d", ErrInvalidDestinations, r.SubtractFeeFrom)
+	}
+	return nil
 }
 
 func (a *Address) String() (s string) {